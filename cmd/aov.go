@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"raytracer/imageio"
+	"raytracer/raytracer"
+	"strings"
+)
+
+// writeAOVs stores the given AOVs of frame next to its color as layers of a
+// single file for .exr paths, other formats get one file per AOV named
+// after it (out.pfm becomes out.albedo.pfm, ...).
+func writeAOVs(path string, frame *raytracer.Frame, aovs []raytracer.AOV, compression string) error {
+	exrCompression, err := imageio.ParseEXRCompression(compression)
+	if err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(path)
+	if !strings.EqualFold(ext, ".exr") {
+		base := strings.TrimSuffix(path, ext)
+		for _, aov := range aovs {
+			if err := imageio.WriteFile(base+"."+aov.String()+ext, frame.AOVs[aov], exrCompression); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	img := frame.Color
+	channels := []imageio.EXRChannel{
+		{Name: "R", Data: img.Channel(0)},
+		{Name: "G", Data: img.Channel(1)},
+		{Name: "B", Data: img.Channel(2)},
+		{Name: "A", Data: img.Channel(3)},
+	}
+	for _, aov := range aovs {
+		for c, name := range aov.Channels() {
+			channels = append(channels, imageio.EXRChannel{Name: aov.String() + "." + name, Data: frame.AOVs[aov].Channel(c)})
+		}
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := imageio.EncodeEXRChannels(file, img.Width, img.Height, channels, exrCompression); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
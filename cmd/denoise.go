@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"raytracer/imageio"
+	"raytracer/raytracer"
+	"raytracer/scene"
+	"slices"
+)
+
+// defaultDenoise returns the settings used when -denoise picks a filter the
+// scene doesn't configure.
+func defaultDenoise(name string) *scene.Denoise {
+	switch name {
+	case "none":
+		return nil
+	case "joint":
+		return &scene.Denoise{Type: name, SpatialSigma: 3, RangeSigma: 0.5, AlbedoSigma: 0.1, NormalSigma: 0.3, DepthSigma: 0.1}
+	case "atrous", "nlm":
+		return &scene.Denoise{Type: name}
+	default:
+		return &scene.Denoise{Type: name, SpatialSigma: 3, RangeSigma: 0.1}
+	}
+}
+
+// denoiseAOVs adds the feature buffers the configured denoiser needs to the
+// AOVs rendered.
+func denoiseAOVs(d *scene.Denoise, aovs []raytracer.AOV) []raytracer.AOV {
+	var features []raytracer.AOV
+	switch {
+	case d == nil:
+	case d.Type == "joint":
+		features = []raytracer.AOV{raytracer.AOVAlbedo, raytracer.AOVNormal, raytracer.AOVDepth}
+	case d.Type == "atrous":
+		features = []raytracer.AOV{raytracer.AOVAlbedo, raytracer.AOVNormal, raytracer.AOVDepth, raytracer.AOVVariance}
+	}
+	aovs = slices.Clone(aovs)
+	for _, feature := range features {
+		if !slices.Contains(aovs, feature) {
+			aovs = append(aovs, feature)
+		}
+	}
+	return aovs
+}
+
+// denoiseHDR runs the denoisers working on linear color, the plain
+// bilateral filter runs on the display image instead.
+func denoiseHDR(d *scene.Denoise, frame *raytracer.Frame) *imageio.FloatImage {
+	if d == nil {
+		return frame.Color
+	}
+	switch d.Type {
+	case "joint":
+		fmt.Println("denoising....")
+		return raytracer.JointBilateralFilter(frame, raytracer.JointBilateralParams{
+			SpatialSigma: d.SpatialSigma,
+			ColorSigma:   d.RangeSigma,
+			AlbedoSigma:  d.AlbedoSigma,
+			NormalSigma:  d.NormalSigma,
+			DepthSigma:   d.DepthSigma,
+		})
+	case "atrous":
+		fmt.Println("denoising....")
+		params := raytracer.DefaultAtrousParams
+		if d.Iterations > 0 {
+			params.Iterations = d.Iterations
+		}
+		if d.RangeSigma > 0 {
+			params.ColorSigma = d.RangeSigma
+		}
+		if d.NormalSigma > 0 {
+			params.NormalSigma = d.NormalSigma
+		}
+		if d.DepthSigma > 0 {
+			params.DepthSigma = d.DepthSigma
+		}
+		return raytracer.AtrousFilter(frame, params)
+	case "nlm":
+		fmt.Println("denoising....")
+		params := raytracer.DefaultNLMeansParams
+		if d.SearchRadius > 0 {
+			params.SearchRadius = d.SearchRadius
+		}
+		if d.PatchRadius > 0 {
+			params.PatchRadius = d.PatchRadius
+		}
+		if d.Strength > 0 {
+			params.Strength = d.Strength
+		}
+		return raytracer.NLMeansFilter(frame.Color, params)
+	}
+	return frame.Color
+}
+
+func compareReference(path string, img *imageio.FloatImage) error {
+	ref, err := imageio.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	rmse, err := imageio.RMSE(img, ref)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	fmt.Printf("RMSE against %s: %.6f\n", path, rmse)
+	return nil
+}
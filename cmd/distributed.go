@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"raytracer/distributed"
+	"raytracer/raytracer"
+	"raytracer/scene"
+	"time"
+)
+
+func serveWorker(addr string, threads int) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("worker listening on %s\n", l.Addr())
+	return distributed.Serve(l, threads)
+}
+
+func renderDistributed(ctx context.Context, doc *scene.Scene, camera *raytracer.Camera, workers []string, tileTimeout time.Duration, opts raytracer.RenderOptions) (*raytracer.Frame, error) {
+	c := distributed.Coordinator{
+		Workers:     workers,
+		AOVs:        opts.AOVs,
+		TileSize:    opts.TileSize,
+		TileOrder:   opts.TileOrder,
+		TileTimeout: tileTimeout,
+		Progress:    opts.Progress,
+		WorkerError: func(addr string, err error) {
+			fmt.Fprintf(os.Stderr, "worker %s: %s\n", addr, err)
+		},
+	}
+	return c.Render(ctx, doc, camera)
+}
@@ -1,72 +1,262 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"image"
 	"image/png"
-	"math/rand/v2"
 	"os"
-	"raytracer/math3"
+	"os/signal"
+	"raytracer/imageio"
 	"raytracer/raytracer"
+	"raytracer/scene"
+	"slices"
+	"strings"
 	"time"
 )
 
 func main() {
-	start := time.Now()
-
-	world := raytracer.World{}
+	scenePath := flag.String("scene", "", "scene file to render, defaults to the built-in random spheres scene")
+	saveScene := flag.String("save-scene", "", "write the scene to this file before rendering")
+	width := flag.Int("width", 0, "override the image width of the scene")
+	samples := flag.Int("spp", 0, "override the samples per pixel of the scene")
+	hdrOutput := flag.String("hdr", "", "also write the linear framebuffer to this .exr, .hdr or .pfm file")
+	integratorName := flag.String("integrator", "", "override the integrator of the scene: path, direct, ao or normals")
+	toneMap := flag.String("tonemap", "", "override the tone mapping operator: clamp, reinhard, reinhard_extended, hable or aces")
+	exposure := flag.Float64("exposure", 0, "override the exposure of the scene in stops")
+	bitDepth := flag.Int("depth", 0, "override the bits per channel of the PNG output: 8 or 16")
+	dither := flag.String("dither", "", "override the dithering of the PNG output: none, ordered or bluenoise")
+	aovList := flag.String("aovs", "", "comma separated AOVs to render: albedo, normal, depth, position, material_id, object_id")
+	denoiser := flag.String("denoise", "", "override the denoiser: none, bilateral, joint, atrous or nlm")
+	adaptive := flag.Float64("adaptive", 0, "sample adaptively, stopping pixels whose noise falls below this threshold")
+	heatmap := flag.String("heatmap", "", "write a PNG of the samples taken per pixel")
+	reference := flag.String("reference", "", "print the RMSE of the (denoised) linear image against this .hdr or .pfm file")
+	progressive := flag.Bool("progressive", false, "refine the whole image pass by pass")
+	snapshotInterval := flag.Duration("snapshot-interval", 0, "with -progressive, write the current estimate to the output this often")
+	checkpoint := flag.String("checkpoint", "", "render progressively, saving the state to this file periodically and when interrupted")
+	checkpointInterval := flag.Duration("checkpoint-interval", 0, "how often to save the checkpoint, defaults to a minute")
+	resumeRender := flag.Bool("resume", false, "continue the render saved in the checkpoint")
+	workerAddr := flag.String("worker", "", "run as a distributed render worker listening on this address, e.g. :7000")
+	seed := flag.Uint64("seed", 0, "override the seed of the render's random numbers, and of the built-in scene")
+	threads := flag.Int("threads", 0, "override the number of rendering goroutines, or tiles a -worker renders at once")
+	tileSize := flag.Int("tile-size", 0, "override the tile edge in pixels")
+	tileOrder := flag.String("tile-order", "", "override the tile order: random, scanline, spiral or hilbert")
+	workers := flag.String("workers", "", "comma separated addresses of workers to render on instead of this machine")
+	tileTimeout := flag.Duration("tile-timeout", 0, "with -workers, give up on a worker taking longer than this for a tile, defaults to 10m")
+	serveAddr := flag.String("serve", "", "render progressively while serving a live preview over HTTP on this address, e.g. :8080")
+	aovOutput := flag.String("aov-output", "", "file the AOVs are written to: one .exr with layers, or a .hdr/.pfm per AOV")
+	flag.Parse()
 
-	ground := raytracer.Lambertian{Albedo: math3.Vec3{0.5, 0.5, 0.5}}
-	world.Add(&raytracer.Sphere{Center: math3.Vec3{0, -1000, -1}, Radius: 1000, Material: ground})
+	if *workerAddr != "" {
+		if err := serveWorker(*workerAddr, *threads); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	for a := -11; a < 11; a++ {
-		for b := -11; b < 11; b++ {
-			chooseMaterial := rand.Float64()
-			center := math3.Vec3{float64(a) + 0.9*rand.Float64(), 0.2, float64(b) + 0.9*rand.Float64()}
+	start := time.Now()
 
-			if center.Sub(math3.Vec3{4, 0.2, 0}).Length() > 0.9 {
-				albedo := math3.Random().Multiply(math3.Random())
-				var material raytracer.Material
-				switch {
-				case chooseMaterial < 0.8:
-					material = raytracer.Lambertian{Albedo: albedo}
-				case chooseMaterial < 0.95:
-					albedo = math3.RandomBetween(0.5, 1)
-					fuzz := math3.RandomBetween(0, 0.5)[0]
-					material = raytracer.Metal{Albedo: albedo, Fuzz: fuzz}
-				default:
-					material = raytracer.Dialectric{RefractionIndex: 1.5}
-				}
-				world.Add(&raytracer.Sphere{Center: center, Radius: 0.2, Material: material})
-			}
+	doc := randomScene(*seed)
+	if *scenePath != "" {
+		var err error
+		if doc, err = scene.Load(*scenePath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if *saveScene != "" {
+		if err := doc.Save(*saveScene); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
 	}
+	if isFlagSet("seed") {
+		doc.Render.Seed = *seed
+	}
+	if *width > 0 {
+		doc.Camera.Width = *width
+	}
+	if *samples > 0 {
+		doc.Camera.SamplesPerPixel = *samples
+	}
+	if *hdrOutput != "" {
+		doc.Render.HDROutput = *hdrOutput
+	}
+	if *integratorName != "" {
+		doc.Render.Integrator = *integratorName
+	}
+	if *toneMap != "" {
+		doc.Render.ToneMap = *toneMap
+	}
+	if isFlagSet("exposure") {
+		doc.Render.Exposure = *exposure
+	}
+	if *bitDepth > 0 {
+		doc.Render.BitDepth = *bitDepth
+	}
+	if *dither != "" {
+		doc.Render.Dither = *dither
+	}
+	if *aovList != "" {
+		doc.Render.AOVs = strings.Split(*aovList, ",")
+	}
+	if *aovOutput != "" {
+		doc.Render.AOVOutput = *aovOutput
+	}
+	if *adaptive > 0 {
+		if doc.Render.Adaptive == nil {
+			doc.Render.Adaptive = &scene.Adaptive{}
+		}
+		doc.Render.Adaptive.Threshold = *adaptive
+	}
+	if *heatmap != "" {
+		doc.Render.HeatmapOutput = *heatmap
+	}
+	if *progressive {
+		doc.Render.Progressive = true
+	}
+	if *snapshotInterval > 0 {
+		doc.Render.SnapshotInterval = snapshotInterval.Seconds()
+	}
+	if *checkpoint != "" {
+		doc.Render.Progressive = true
+		doc.Render.Checkpoint = *checkpoint
+	}
+	if *checkpointInterval > 0 {
+		doc.Render.CheckpointInterval = checkpointInterval.Seconds()
+	}
+	if *threads > 0 {
+		doc.Render.Threads = *threads
+	}
+	if *tileSize > 0 {
+		doc.Render.TileSize = *tileSize
+	}
+	if *tileOrder != "" {
+		doc.Render.TileOrder = *tileOrder
+	}
+	if *workers != "" && doc.Render.Progressive {
+		fmt.Fprintln(os.Stderr, "-workers can't be combined with progressive rendering")
+		os.Exit(1)
+	}
+	if *resumeRender && doc.Render.Checkpoint == "" {
+		fmt.Fprintln(os.Stderr, "-resume requires a checkpoint file")
+		os.Exit(1)
+	}
+	if *denoiser != "" && (doc.Render.Denoise == nil || doc.Render.Denoise.Type != *denoiser) {
+		doc.Render.Denoise = defaultDenoise(*denoiser)
+	}
 
-	mat1 := raytracer.Dialectric{RefractionIndex: 1.5}
-	mat2 := raytracer.Lambertian{Albedo: math3.Vec3{0.4, 0.2, 0.1}}
-	mat3 := raytracer.Metal{Albedo: math3.Vec3{0.7, 0.6, 0.5}, Fuzz: 0.0}
+	world, camera, err := doc.Build()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, warning := range doc.Warnings() {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+	opts, err := doc.RenderOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	toneMapper, err := doc.ToneMapper()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	aovs, err := doc.AOVs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-	world.Add(&raytracer.Sphere{Center: math3.Vec3{0, 1, 0}, Radius: 1, Material: mat1})
-	world.Add(&raytracer.Sphere{Center: math3.Vec3{-4, 1, 0}, Radius: 1, Material: mat2})
-	world.Add(&raytracer.Sphere{Center: math3.Vec3{4, 1, 0}, Radius: 1, Material: mat3})
+	renderAOVs := denoiseAOVs(doc.Render.Denoise, aovs)
+	if doc.Render.HeatmapOutput != "" && !slices.Contains(renderAOVs, raytracer.AOVSamples) {
+		renderAOVs = append(renderAOVs, raytracer.AOVSamples)
+	}
 
-	world.Prepare()
-	camera := raytracer.NewCamera(raytracer.CameraParams{
-		Width:           1200,
-		AspectRatio:     16 / 9.0,
-		SamplesPerPixel: 500,
-		MaxDepth:        50,
-		VFov:            20,
-		LookFrom:        math3.Vec3{13, 2, 3},
-		LookAt:          math3.Vec3{0, 0, 0},
-		DefocusAngle:    0.6,
-		FocusDist:       10,
-	})
-	render := camera.Render(&world, true)
-	fmt.Println("denoising....")
-	img := raytracer.BilateralFilter(render, 3.0, 0.2)
-	file, err := os.Create("final-screenshot.png")
+	ditherMode, err := raytracer.ParseDither(doc.Render.Dither)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	output := doc.Render.Output
+	if output == "" {
+		output = "final-screenshot.png"
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *serveAddr != "" {
+		if err := serve(ctx, *serveAddr, doc, world, toneMapper); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	opts.Progress = printProgress
+	opts.AOVs = renderAOVs
+	var frame *raytracer.Frame
+	if *workers != "" {
+		frame, err = renderDistributed(ctx, doc, camera, strings.Split(*workers, ","), *tileTimeout, opts)
+	} else if doc.Render.Progressive {
+		p := camera.NewProgressive(world, opts)
+		if *resumeRender {
+			if err := resume(p, doc); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		frame, err = renderProgressive(ctx, p, doc, func(img *imageio.FloatImage) error {
+			return writePNG(output, raytracer.ToImage(toneMapper.Apply(img), doc.Render.BitDepth, ditherMode))
+		})
+	} else {
+		frame, err = camera.Render(ctx, world, opts)
+	}
+	if err != nil {
+		fmt.Printf("render interrupted (%s), saving partial image\n", err)
+	}
+	hdr := frame.Color
+	if doc.Render.HDROutput != "" {
+		if err := writeHDR(doc.Render.HDROutput, hdr, doc.Render.EXRCompression); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if len(aovs) > 0 {
+		if err := writeAOVs(doc.Render.AOVOutput, frame, aovs, doc.Render.EXRCompression); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if doc.Render.HeatmapOutput != "" {
+		maxSamples := doc.Camera.SamplesPerPixel
+		if a := doc.AdaptiveSampling(); a != nil {
+			maxSamples = a.MaxSamples
+		}
+		if err := writePNG(doc.Render.HeatmapOutput, raytracer.Heatmap(frame.AOVs[raytracer.AOVSamples], maxSamples)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	hdr = denoiseHDR(doc.Render.Denoise, frame)
+	if *reference != "" {
+		if err := compareReference(*reference, hdr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	render := raytracer.ToImage(toneMapper.Apply(hdr), doc.Render.BitDepth, ditherMode)
+	img := render
+	if d := doc.Render.Denoise; d != nil && (d.Type == "" || d.Type == "bilateral") {
+		fmt.Println("denoising....")
+		img = raytracer.BilateralFilter(render, doc.Render.Denoise.SpatialSigma, doc.Render.Denoise.RangeSigma)
+	}
+	file, err := os.Create(output)
 	if err != nil {
-		panic("Could not open final-screenshot.png")
+		panic("Could not open " + output)
 	}
 	defer file.Close()
 	if err := png.Encode(file, img); err != nil {
@@ -75,3 +265,31 @@ func main() {
 	total := time.Since(start)
 	fmt.Printf("Took: %s\n", total.String())
 }
+
+func writeHDR(path string, img *imageio.FloatImage, compression string) error {
+	exrCompression, err := imageio.ParseEXRCompression(compression)
+	if err != nil {
+		return err
+	}
+	return imageio.WriteFile(path, img, exrCompression)
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+func writePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"raytracer/raytracer"
+	"time"
+)
+
+func printProgress(event raytracer.ProgressEvent) {
+	if event.Pass > 0 {
+		fmt.Printf("Pass %d: ", event.Pass)
+	}
+	fmt.Printf(
+		"Finished tile %d (%d of %d) - %.1f%% - %d samples - elapsed %s - eta %s\n",
+		event.Tile.Chunk,
+		event.TilesDone,
+		event.TilesTotal,
+		100*float64(event.PixelsDone)/float64(event.PixelsTotal),
+		event.Samples,
+		formatDuration(event.Elapsed),
+		formatDuration(event.ETA),
+	)
+}
+
+func formatDuration(d time.Duration) string {
+	h := d / time.Hour
+	d -= h * time.Hour
+
+	m := d / time.Minute
+	d -= m * time.Minute
+
+	s := d / time.Second
+	d -= s * time.Second
+
+	ms := d / time.Millisecond
+	d -= ms * time.Millisecond
+
+	us := d / time.Microsecond
+
+	result := ""
+	if h > 0 {
+		result += fmt.Sprintf("%dh", h)
+	}
+	if m > 0 {
+		result += fmt.Sprintf("%dm", m)
+	}
+	if s > 0 {
+		result += fmt.Sprintf("%ds", s)
+	}
+	if ms > 0 {
+		result += fmt.Sprintf("%dms", ms)
+	}
+	if us > 0 && result == "" { // only show microseconds if it's the only value
+		result += fmt.Sprintf("%dµs", us)
+	}
+	return result
+}
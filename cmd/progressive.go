@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"raytracer/imageio"
+	"raytracer/raytracer"
+	"raytracer/scene"
+	"sync"
+	"time"
+)
+
+const defaultCheckpointInterval = time.Minute
+
+// renderProgressive runs a progressive render, handing the current estimate
+// to save every render.snapshotInterval and whenever one of snapshotSignals
+// arrives, and saving checkpoints to render.checkpoint, the last one once
+// the render stops.
+func renderProgressive(ctx context.Context, p *raytracer.Progressive, doc *scene.Scene, save func(*imageio.FloatImage) error) (*raytracer.Frame, error) {
+	mu := sync.Mutex{}
+	snapshot := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := save(p.Snapshot()); err != nil {
+			fmt.Fprintln(os.Stderr, "snapshot:", err)
+		} else {
+			fmt.Printf("snapshot saved after %d passes\n", p.Passes())
+		}
+	}
+	stopSnapshots := every(seconds(doc.Render.SnapshotInterval), snapshot)
+	stopSignals := on(snapshotSignals, snapshot)
+	path := doc.Render.Checkpoint
+	interval := seconds(doc.Render.CheckpointInterval)
+	if interval == 0 {
+		interval = defaultCheckpointInterval
+	}
+	checkpoint := func() {
+		c := p.Checkpoint()
+		c.Scene = doc.Hash()
+		if err := c.Save(path); err != nil {
+			fmt.Fprintln(os.Stderr, "checkpoint:", err)
+		} else {
+			fmt.Printf("checkpoint saved to %s after %d passes\n", path, c.Passes)
+		}
+	}
+	stopCheckpoints := func() {}
+	if path != "" {
+		stopCheckpoints = every(interval, checkpoint)
+	}
+
+	frame, err := p.Run(ctx)
+	stopSnapshots()
+	stopSignals()
+	stopCheckpoints()
+	if path != "" {
+		checkpoint()
+	}
+	return frame, err
+}
+
+// resume loads the checkpoint of a previous render of doc into p.
+func resume(p *raytracer.Progressive, doc *scene.Scene) error {
+	path := doc.Render.Checkpoint
+	c, err := raytracer.LoadCheckpoint(path)
+	if err != nil {
+		return err
+	}
+	if c.Scene != doc.Hash() {
+		return fmt.Errorf("%s: the scene or camera changed since the checkpoint was saved", path)
+	}
+	if err := p.Resume(c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	fmt.Printf("resuming after %d passes, %d samples per pixel\n", c.Passes, c.SamplesPerPixel)
+	return nil
+}
+
+// every calls fn every interval until the returned function is called, which
+// waits for a call in progress. A zero interval never calls fn.
+func every(interval time.Duration, fn func()) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// on calls fn every time one of signals arrives until the returned function
+// is called, which waits for a call in progress.
+func on(signals []os.Signal, fn func()) func() {
+	if len(signals) == 0 {
+		return func() {}
+	}
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-received:
+				fn()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(received)
+		close(done)
+		wg.Wait()
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"raytracer/math3"
+	"raytracer/scene"
+)
+
+// randomScene is the final scene of Ray Tracing in One Weekend: a field of
+// small random spheres around three large ones, placed by seed.
+func randomScene(seed uint64) *scene.Scene {
+	rng := math3.NewSampler(seed)
+	doc := scene.New()
+	doc.Camera = scene.Camera{
+		Width:           1200,
+		AspectRatio:     16 / 9.0,
+		SamplesPerPixel: 500,
+		MaxDepth:        50,
+		VFov:            20,
+		LookFrom:        scene.Vector{13, 2, 3},
+		LookAt:          scene.Vector{0, 0, 0},
+		DefocusAngle:    0.6,
+		FocusDist:       10,
+	}
+	doc.Render = scene.Render{
+		Output:  "final-screenshot.png",
+		Denoise: &scene.Denoise{SpatialSigma: 3.0, RangeSigma: 0.2},
+		Seed:    seed,
+	}
+
+	doc.Materials["ground"] = scene.Material{Type: "lambertian", Albedo: scene.Vector{0.5, 0.5, 0.5}}
+	doc.Objects = append(doc.Objects, scene.Object{
+		Type: "sphere", Center: scene.Vector{0, -1000, -1}, Radius: 1000, Material: "ground",
+	})
+
+	for a := -11; a < 11; a++ {
+		for b := -11; b < 11; b++ {
+			chooseMaterial := rng.Float64()
+			center := math3.Vec3{float64(a) + 0.9*rng.Float64(), 0.2, float64(b) + 0.9*rng.Float64()}
+
+			if center.Sub(math3.Vec3{4, 0.2, 0}).Length() > 0.9 {
+				albedo := math3.Random(rng).Multiply(math3.Random(rng))
+				var material scene.Material
+				switch {
+				case chooseMaterial < 0.8:
+					material = scene.Material{Type: "lambertian", Albedo: albedo[:]}
+				case chooseMaterial < 0.95:
+					albedo = math3.RandomBetween(rng, 0.5, 1)
+					fuzz := math3.RandomBetween(rng, 0, 0.5)[0]
+					material = scene.Material{Type: "metal", Albedo: albedo[:], Fuzz: fuzz}
+				default:
+					material = scene.Material{Type: "dielectric", RefractionIndex: 1.5}
+				}
+				name := fmt.Sprintf("small-%d-%d", a, b)
+				doc.Materials[name] = material
+				doc.Objects = append(doc.Objects, scene.Object{
+					Type: "sphere", Center: center[:], Radius: 0.2, Material: name,
+				})
+			}
+		}
+	}
+
+	doc.Materials["glass"] = scene.Material{Type: "dielectric", RefractionIndex: 1.5}
+	doc.Materials["brown"] = scene.Material{Type: "lambertian", Albedo: scene.Vector{0.4, 0.2, 0.1}}
+	doc.Materials["mirror"] = scene.Material{Type: "metal", Albedo: scene.Vector{0.7, 0.6, 0.5}, Fuzz: 0.0}
+
+	doc.Objects = append(doc.Objects,
+		scene.Object{Type: "sphere", Center: scene.Vector{0, 1, 0}, Radius: 1, Material: "glass"},
+		scene.Object{Type: "sphere", Center: scene.Vector{-4, 1, 0}, Radius: 1, Material: "brown"},
+		scene.Object{Type: "sphere", Center: scene.Vector{4, 1, 0}, Radius: 1, Material: "mirror"},
+	)
+	return doc
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"raytracer/preview"
+	"raytracer/raytracer"
+	"raytracer/scene"
+)
+
+// serve renders doc while serving the preview on addr until ctx is done.
+func serve(ctx context.Context, addr string, doc *scene.Scene, world *raytracer.World, toneMapper raytracer.ToneMapper) error {
+	s := preview.New(ctx, doc, world, toneMapper)
+	if err := s.Start(doc.Camera); err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("serving the preview on http://%s\n", l.Addr())
+	server := &http.Server{
+		Handler:     s.Handler(),
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	stop := context.AfterFunc(ctx, func() { server.Close() })
+	defer stop()
+	if err := server.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
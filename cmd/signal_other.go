@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// snapshotSignals ask a progressive render to save its current estimate,
+// there is no spare signal to use on this platform.
+var snapshotSignals []os.Signal
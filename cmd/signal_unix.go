@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// snapshotSignals ask a progressive render to save its current estimate.
+var snapshotSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,230 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/rpc"
+	"path/filepath"
+	"raytracer/raytracer"
+	"raytracer/scene"
+	"sync"
+	"time"
+)
+
+const defaultTileTimeout = 10 * time.Minute
+
+// Coordinator renders a scene on remote workers, see Serve.
+type Coordinator struct {
+	// addresses the workers listen on
+	Workers []string
+	// auxiliary outputs rendered along with the color
+	AOVs []raytracer.AOV
+	// tiles handed out, see raytracer.Camera.Tiles
+	TileSize  int
+	TileOrder raytracer.TileOrder
+	// how long a worker may take to load the scene or render a tile before
+	// it is considered lost, zero uses ten minutes
+	TileTimeout time.Duration
+	// Progress is called every time a tile arrives, calls are serialized
+	Progress func(raytracer.ProgressEvent)
+	// WorkerError is called when a worker can't be reached, fails to load
+	// the scene or is lost during the render
+	WorkerError func(addr string, err error)
+}
+
+// Render ships doc to the workers and hands out cam's tiles, each worker
+// renders as many at once as it has threads. The tiles in flight on a worker
+// that fails go back to the queue for the others. Files doc references must
+// be at the same absolute path on the workers, one missing a file fails to
+// load the scene. When ctx is done the tiles received so far are returned
+// along with the context's error.
+func (c *Coordinator) Render(ctx context.Context, doc *scene.Scene, cam *raytracer.Camera) (*raytracer.Frame, error) {
+	frame := raytracer.NewFrame(cam.Width, cam.Height, c.AOVs)
+	buf := bytes.Buffer{}
+	if err := doc.Encode(&buf); err != nil {
+		return frame, err
+	}
+	dir, err := filepath.Abs(doc.Dir())
+	if err != nil {
+		return frame, err
+	}
+	args := LoadArgs{Scene: buf.Bytes(), Dir: dir, AOVs: c.AOVs}
+	for _, warning := range doc.Warnings() {
+		args.Warnings = append(args.Warnings, warning.Error())
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := cam.Tiles(c.TileSize, c.TileOrder)
+	timeout := c.TileTimeout
+	if timeout <= 0 {
+		timeout = defaultTileTimeout
+	}
+	a := &assembly{
+		frame:     frame,
+		timeout:   timeout,
+		queue:     make(chan raytracer.WorkerJob, len(jobs)),
+		done:      cancel,
+		remaining: len(jobs),
+		progress:  c.Progress,
+		start:     time.Now(),
+	}
+	for _, job := range jobs {
+		a.queue <- job
+		a.pixelsTotal += job.Pixels()
+	}
+	if len(jobs) == 0 {
+		return frame, nil
+	}
+
+	wg := sync.WaitGroup{}
+	for _, addr := range c.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.work(runCtx, addr, args); err != nil && runCtx.Err() == nil && c.WorkerError != nil {
+				c.WorkerError(addr, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return frame, ctx.Err()
+	}
+	if remaining := a.tilesLeft(); remaining > 0 {
+		return frame, fmt.Errorf("no workers left with %d of %d tiles unrendered", remaining, len(jobs))
+	}
+	return frame, nil
+}
+
+// assembly collects the tiles of a render.
+type assembly struct {
+	frame *raytracer.Frame
+	// tiles not handed out yet, or handed back by a failed worker
+	queue chan raytracer.WorkerJob
+	// called once the last tile arrives
+	done func()
+	// limit on every call to a worker, see call
+	timeout     time.Duration
+	progress    func(raytracer.ProgressEvent)
+	start       time.Time
+	mu          sync.Mutex
+	remaining   int
+	pixelsDone  int
+	pixelsTotal int
+	samples     int64
+}
+
+// work renders tiles on the worker at addr until there are none left or ctx
+// is done, it returns why the worker was lost otherwise.
+func (a *assembly) work(ctx context.Context, addr string, args LoadArgs) error {
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	// unblock the calls in flight when the render stops
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	defer stop()
+	reply := LoadReply{}
+	if err := a.call(client, "Worker.Load", args, &reply); err != nil {
+		return err
+	}
+	threads := max(reply.Threads, 1)
+	errs := make(chan error, threads)
+	for range threads {
+		go func() { errs <- a.renderTiles(ctx, client) }()
+	}
+	var first error
+	for range threads {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// renderTiles renders one tile at a time on client. On failure the tile is
+// queued again and the connection closed, failing its other calls too.
+func (a *assembly) renderTiles(ctx context.Context, client *rpc.Client) error {
+	for {
+		var job raytracer.WorkerJob
+		select {
+		case job = <-a.queue:
+		case <-ctx.Done():
+			return nil
+		}
+		tile := Tile{}
+		err := a.call(client, "Worker.Render", job, &tile)
+		if err == nil {
+			err = a.add(job, tile)
+		}
+		if err != nil {
+			a.queue <- job
+			client.Close()
+			return err
+		}
+	}
+}
+
+// call is client.Call giving up after the assembly's timeout, so a worker
+// that hangs without closing the connection is lost like one that does. The
+// client is closed on timeout, failing its other calls too.
+func (a *assembly) call(client *rpc.Client, method string, args any, reply any) error {
+	timer := time.NewTimer(a.timeout)
+	defer timer.Stop()
+	select {
+	case c := <-client.Go(method, args, reply, make(chan *rpc.Call, 1)).Done:
+		return c.Error
+	case <-timer.C:
+		client.Close()
+		return fmt.Errorf("%s timed out after %s", method, a.timeout)
+	}
+}
+
+func (a *assembly) add(job raytracer.WorkerJob, tile Tile) error {
+	for aov := range a.frame.AOVs {
+		if _, ok := tile.AOVs[aov]; !ok {
+			return fmt.Errorf("tile %d is missing the %s AOV", job.Chunk, aov)
+		}
+	}
+	if err := paste(a.frame.Color, job, tile.Color); err != nil {
+		return err
+	}
+	for aov, img := range a.frame.AOVs {
+		if err := paste(img, job, tile.AOVs[aov]); err != nil {
+			return err
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.remaining--
+	a.pixelsDone += job.Pixels()
+	a.samples += tile.Samples
+	if a.progress != nil {
+		elapsed := time.Since(a.start)
+		a.progress(raytracer.ProgressEvent{
+			Tile:        job,
+			TilesDone:   cap(a.queue) - a.remaining,
+			TilesTotal:  cap(a.queue),
+			PixelsDone:  a.pixelsDone,
+			PixelsTotal: a.pixelsTotal,
+			Samples:     a.samples,
+			Elapsed:     elapsed,
+			ETA:         time.Duration(float64(elapsed) * float64(a.pixelsTotal-a.pixelsDone) / float64(a.pixelsDone)),
+		})
+	}
+	if a.remaining == 0 {
+		a.done()
+	}
+	return nil
+}
+
+func (a *assembly) tilesLeft() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.remaining
+}
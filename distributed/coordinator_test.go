@@ -0,0 +1,278 @@
+package distributed
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"raytracer/raytracer"
+	"raytracer/scene"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// trackingListener remembers the connections it accepts so a test can cut
+// them.
+type trackingListener struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, conn)
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+func (l *trackingListener) closeConns() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, conn := range l.conns {
+		conn.Close()
+	}
+}
+
+func startWorker(t *testing.T) *trackingListener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tl := &trackingListener{Listener: l}
+	go Serve(tl, 1)
+	t.Cleanup(func() {
+		l.Close()
+		tl.closeConns()
+	})
+	return tl
+}
+
+// startWorkerProcess runs a worker in a child process running
+// TestHelperWorkerProcess, so it can be killed like a lost machine.
+func startWorkerProcess(t *testing.T) (string, *exec.Cmd) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperWorkerProcess$")
+	cmd.Env = append(os.Environ(), "DISTRIBUTED_TEST_WORKER=1")
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	addr, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("worker process: %v", err)
+	}
+	return strings.TrimSpace(addr), cmd
+}
+
+// TestHelperWorkerProcess is the worker started by startWorkerProcess, it
+// prints its address and serves until killed.
+func TestHelperWorkerProcess(t *testing.T) {
+	if os.Getenv("DISTRIBUTED_TEST_WORKER") != "1" {
+		t.Skip("only runs as a worker process")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(l.Addr())
+	Serve(l, 1)
+}
+
+func testScene() *scene.Scene {
+	doc := scene.New()
+	doc.Camera = scene.Camera{
+		Width:           32,
+		AspectRatio:     1,
+		SamplesPerPixel: 4,
+		MaxDepth:        8,
+		VFov:            40,
+		LookFrom:        scene.Vector{0, 1, 5},
+		LookAt:          scene.Vector{0, 0, 0},
+		FocusDist:       5,
+	}
+	doc.Render = scene.Render{Seed: 7}
+	doc.Materials["ground"] = scene.Material{Type: "lambertian", Albedo: scene.Vector{0.5, 0.5, 0.5}}
+	doc.Materials["red"] = scene.Material{Type: "lambertian", Albedo: scene.Vector{0.7, 0.1, 0.1}}
+	doc.Materials["mirror"] = scene.Material{Type: "metal", Albedo: scene.Vector{0.8, 0.8, 0.8}, Fuzz: 0.1}
+	doc.Objects = []scene.Object{
+		{Type: "sphere", Center: scene.Vector{0, -100.5, 0}, Radius: 100, Material: "ground"},
+		{Type: "sphere", Center: scene.Vector{-0.6, 0, 0}, Radius: 0.5, Material: "red"},
+		{Type: "sphere", Center: scene.Vector{0.6, 0, 0}, Radius: 0.5, Material: "mirror"},
+	}
+	return doc
+}
+
+func TestCoordinatorRequeuesTilesOfLostWorker(t *testing.T) {
+	kept, lost := startWorker(t), startWorker(t)
+	doc := testScene()
+	world, cam, err := doc.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const tileSize = 4
+	tiles := map[int]int{}
+	cut := sync.Once{}
+	mu := sync.Mutex{}
+	failed := []string{}
+	c := Coordinator{
+		Workers:  []string{kept.Addr().String(), lost.Addr().String()},
+		TileSize: tileSize,
+		Progress: func(event raytracer.ProgressEvent) {
+			tiles[event.Tile.Chunk]++
+			if event.TilesDone == 3 {
+				cut.Do(lost.closeConns)
+			}
+		},
+		WorkerError: func(addr string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, addr)
+		},
+	}
+	// a tile that is never requeued leaves the render waiting for it
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	frame, err := c.Render(ctx, doc, cam)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := cam.Tiles(tileSize, raytracer.TileRandom)
+	if len(tiles) != len(jobs) {
+		t.Errorf("received %d distinct tiles, expected %d", len(tiles), len(jobs))
+	}
+	for chunk, n := range tiles {
+		if n != 1 {
+			t.Errorf("tile %d received %d times", chunk, n)
+		}
+	}
+	if !slices.Equal(failed, []string{lost.Addr().String()}) {
+		t.Errorf("workers reported lost: %v, expected only %s", failed, lost.Addr())
+	}
+
+	opts, err := doc.RenderOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := cam.Render(context.Background(), world, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(frame.Color.Pix, local.Color.Pix) {
+		t.Error("distributed image differs from the local render")
+	}
+}
+
+func TestCoordinatorTimesOutHungWorker(t *testing.T) {
+	// accepts connections but never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hung := &trackingListener{Listener: l}
+	go func() {
+		for {
+			if _, err := hung.Accept(); err != nil {
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		l.Close()
+		hung.closeConns()
+	})
+
+	doc := testScene()
+	_, cam, err := doc.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Coordinator{Workers: []string{hung.Addr().String()}, TileTimeout: 100 * time.Millisecond}
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Render(context.Background(), doc, cam)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("render without a responding worker succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("render did not give up on the hung worker")
+	}
+}
+
+func TestCoordinatorRequeuesTilesOfKilledWorkerProcess(t *testing.T) {
+	keptAddr, _ := startWorkerProcess(t)
+	lostAddr, lost := startWorkerProcess(t)
+	doc := testScene()
+	world, cam, err := doc.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const tileSize = 4
+	tiles := map[int]int{}
+	kill := sync.Once{}
+	mu := sync.Mutex{}
+	failed := []string{}
+	c := Coordinator{
+		Workers:  []string{keptAddr, lostAddr},
+		TileSize: tileSize,
+		Progress: func(event raytracer.ProgressEvent) {
+			tiles[event.Tile.Chunk]++
+			if event.TilesDone == 3 {
+				kill.Do(func() { lost.Process.Kill() })
+			}
+		},
+		WorkerError: func(addr string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, addr)
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	frame, err := c.Render(ctx, doc, cam)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if jobs := cam.Tiles(tileSize, raytracer.TileRandom); len(tiles) != len(jobs) {
+		t.Errorf("received %d distinct tiles, expected %d", len(tiles), len(jobs))
+	}
+	if !slices.Equal(failed, []string{lostAddr}) {
+		t.Errorf("workers reported lost: %v, expected only %s", failed, lostAddr)
+	}
+	opts, err := doc.RenderOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := cam.Render(context.Background(), world, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(frame.Color.Pix, local.Color.Pix) {
+		t.Error("distributed image differs from the local render")
+	}
+}
@@ -0,0 +1,166 @@
+// Package distributed spreads a render over several processes: workers
+// listen for a coordinator, which ships them the scene and hands out tiles
+// over net/rpc.
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/rpc"
+	"raytracer/imageio"
+	"raytracer/raytracer"
+	"raytracer/scene"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// LoadArgs ships a scene to a worker.
+type LoadArgs struct {
+	// JSON scene document, see scene.Decode
+	Scene []byte
+	// directory file references are resolved from, the files must be at the
+	// same place on the workers
+	Dir  string
+	AOVs []raytracer.AOV
+	// warnings the coordinator built the scene with, a worker with others is
+	// missing files and would render a different image
+	Warnings []string
+}
+
+type LoadReply struct {
+	// number of tiles the worker renders at the same time
+	Threads int
+}
+
+// Tile is a rendered job: its rows of RGBA pixels for the color and every
+// AOV, and the samples it took.
+type Tile struct {
+	Color   []float32
+	AOVs    map[raytracer.AOV][]float32
+	Samples int64
+}
+
+// worker renders tiles for the coordinator on one connection.
+type worker struct {
+	// done when the coordinator disconnects
+	ctx     context.Context
+	threads int
+	mu      sync.Mutex
+	cam     *raytracer.Camera
+	world   *raytracer.World
+	opts    raytracer.RenderOptions
+	frame   *raytracer.Frame
+}
+
+func (w *worker) Load(args LoadArgs, reply *LoadReply) error {
+	doc, err := scene.Decode(bytes.NewReader(args.Scene))
+	if err != nil {
+		return err
+	}
+	doc.SetDir(args.Dir)
+	world, cam, err := doc.Build()
+	if errors.Is(err, fs.ErrNotExist) {
+		return missingFile(err)
+	}
+	if err != nil {
+		return err
+	}
+	for _, warning := range doc.Warnings() {
+		if !slices.Contains(args.Warnings, warning.Error()) {
+			return missingFile(warning)
+		}
+	}
+	opts, err := doc.RenderOptions()
+	if err != nil {
+		return err
+	}
+	opts.AOVs = args.AOVs
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cam, w.world, w.opts = cam, world, opts
+	w.frame = raytracer.NewFrame(cam.Width, cam.Height, args.AOVs)
+	reply.Threads = w.threads
+	return nil
+}
+
+func (w *worker) Render(job raytracer.WorkerJob, tile *Tile) error {
+	w.mu.Lock()
+	cam, world, opts, frame := w.cam, w.world, w.opts, w.frame
+	w.mu.Unlock()
+	if cam == nil {
+		return errors.New("no scene loaded")
+	}
+	if job.XStart < 0 || job.YStart < 0 || job.XEnd > cam.Width || job.YEnd > cam.Height || job.XStart >= job.XEnd || job.YStart >= job.YEnd {
+		return fmt.Errorf("tile %d is outside the %dx%d image", job.Chunk, cam.Width, cam.Height)
+	}
+	samples, err := cam.RenderTile(w.ctx, frame, world, opts, job)
+	if err != nil {
+		return err
+	}
+	tile.Color = crop(frame.Color, job)
+	tile.AOVs = map[raytracer.AOV][]float32{}
+	for aov, img := range frame.AOVs {
+		tile.AOVs[aov] = crop(img, job)
+	}
+	tile.Samples = samples
+	return nil
+}
+
+// missingFile explains a scene file the coordinator has but the worker
+// doesn't.
+func missingFile(err error) error {
+	return fmt.Errorf("files the scene references must be at the same path on every worker: %w", err)
+}
+
+// Serve accepts coordinator connections on l until it is closed, each
+// connection can load a scene and render that many tiles at once, zero
+// uses one per core.
+func Serve(l net.Listener, threads int) error {
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveConn(conn, threads)
+	}
+}
+
+func serveConn(conn net.Conn, threads int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := rpc.NewServer()
+	if err := server.RegisterName("Worker", &worker{ctx: ctx, threads: threads}); err != nil {
+		panic(err)
+	}
+	server.ServeConn(conn)
+}
+
+// crop returns the rows of a job's pixels.
+func crop(img *imageio.FloatImage, job raytracer.WorkerJob) []float32 {
+	pix := make([]float32, 0, 4*job.Pixels())
+	for y := job.YStart; y < job.YEnd; y++ {
+		pix = append(pix, img.Pix[4*(y*img.Width+job.XStart):4*(y*img.Width+job.XEnd)]...)
+	}
+	return pix
+}
+
+// paste is the inverse of crop.
+func paste(img *imageio.FloatImage, job raytracer.WorkerJob, pix []float32) error {
+	if len(pix) != 4*job.Pixels() {
+		return fmt.Errorf("tile %d has %d values, expected %d", job.Chunk, len(pix), 4*job.Pixels())
+	}
+	rowLength := 4 * (job.XEnd - job.XStart)
+	for y := job.YStart; y < job.YEnd; y++ {
+		copy(img.Pix[4*(y*img.Width+job.XStart):], pix[:rowLength])
+		pix = pix[rowLength:]
+	}
+	return nil
+}
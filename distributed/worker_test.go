@@ -0,0 +1,76 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"raytracer/scene"
+	"strings"
+	"testing"
+)
+
+func TestWorkerLoadMissingFile(t *testing.T) {
+	// the coordinator has the model and its material library, the workers
+	// resolve the scene's files in other directories
+	coordinator, noMTL, empty := t.TempDir(), t.TempDir(), t.TempDir()
+	obj := "mtllib model.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nusemtl red\nf 1 2 3\n"
+	for _, dir := range []string{coordinator, noMTL} {
+		if err := os.WriteFile(filepath.Join(dir, "model.obj"), []byte(obj), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(coordinator, "model.mtl"), []byte("newmtl red\nKd 0.7 0.1 0.1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := testScene()
+	doc.Objects = append(doc.Objects, scene.Object{Type: "obj", File: "model.obj"})
+	doc.SetDir(coordinator)
+	if _, _, err := doc.Build(); err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.Buffer{}
+	if err := doc.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// a coordinator without the material library warns about it too
+	shared, err := scene.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared.SetDir(noMTL)
+	if _, _, err := shared.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if len(shared.Warnings()) != 1 {
+		t.Fatalf("warnings %v, expected the missing material library", shared.Warnings())
+	}
+	sharedWarnings := []string{}
+	for _, warning := range shared.Warnings() {
+		sharedWarnings = append(sharedWarnings, warning.Error())
+	}
+
+	tests := []struct {
+		name     string
+		dir      string
+		warnings []string
+		want     string
+	}{
+		{"same files", coordinator, nil, ""},
+		{"missing model", empty, nil, "no such file"},
+		{"missing material library", noMTL, nil, "model.mtl"},
+		{"material library missing on the coordinator too", noMTL, sharedWarnings, ""},
+	}
+	for _, test := range tests {
+		w := &worker{ctx: context.Background(), threads: 1}
+		err := w.Load(LoadArgs{Scene: buf.Bytes(), Dir: test.dir, Warnings: test.warnings}, &LoadReply{})
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.want != "" && (err == nil || !strings.Contains(err.Error(), "same path on every worker") || !strings.Contains(err.Error(), test.want)):
+			t.Errorf("%s: got error %v, expected one about %s", test.name, err, test.want)
+		}
+	}
+}
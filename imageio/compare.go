@@ -0,0 +1,22 @@
+package imageio
+
+import (
+	"fmt"
+	"math"
+)
+
+// RMSE is the root mean square difference between the RGB channels of two
+// images of the same size.
+func RMSE(a *FloatImage, b *FloatImage) (float64, error) {
+	if a.Width != b.Width || a.Height != b.Height {
+		return 0, fmt.Errorf("image sizes differ: %dx%d and %dx%d", a.Width, a.Height, b.Width, b.Height)
+	}
+	sum := 0.0
+	for i := 0; i < len(a.Pix); i += 4 {
+		for c := range 3 {
+			d := float64(a.Pix[i+c] - b.Pix[i+c])
+			sum += d * d
+		}
+	}
+	return math.Sqrt(sum / float64(3*a.Width*a.Height)), nil
+}
@@ -0,0 +1,267 @@
+package imageio
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+)
+
+type EXRCompression uint8
+
+// values match the compression attribute of the OpenEXR file format
+const (
+	EXRNone EXRCompression = 0
+	EXRRLE  EXRCompression = 1
+	EXRZIPS EXRCompression = 2
+	EXRZIP  EXRCompression = 3
+)
+
+const (
+	exrMagic      = 20000630
+	exrVersion    = 2
+	exrPixelFloat = 2
+)
+
+func ParseEXRCompression(s string) (EXRCompression, error) {
+	switch strings.ToLower(s) {
+	case "", "zip":
+		return EXRZIP, nil
+	case "zips":
+		return EXRZIPS, nil
+	case "rle":
+		return EXRRLE, nil
+	case "none":
+		return EXRNone, nil
+	}
+	return EXRNone, fmt.Errorf("unknown exr compression %q", s)
+}
+
+func (c EXRCompression) linesPerBlock() int {
+	if c == EXRZIP {
+		return 16
+	}
+	return 1
+}
+
+// EXRChannel is one plane of Width*Height values, names follow the OpenEXR
+// conventions (R, G, B, A, Z, or layer.R for layered images).
+type EXRChannel struct {
+	Name string
+	Data []float32
+}
+
+// EncodeEXR writes img as a single part scanline OpenEXR file with 32-bit
+// float R, G, B and A channels.
+func EncodeEXR(w io.Writer, img *FloatImage, compression EXRCompression) error {
+	channels := []EXRChannel{
+		{Name: "R", Data: img.Channel(0)},
+		{Name: "G", Data: img.Channel(1)},
+		{Name: "B", Data: img.Channel(2)},
+		{Name: "A", Data: img.Channel(3)},
+	}
+	return EncodeEXRChannels(w, img.Width, img.Height, channels, compression)
+}
+
+func EncodeEXRChannels(w io.Writer, width int, height int, channels []EXRChannel, compression EXRCompression) error {
+	if compression > EXRZIP {
+		return fmt.Errorf("unsupported exr compression %d", compression)
+	}
+	// channels are stored sorted by name
+	channels = slices.Clone(channels)
+	slices.SortFunc(channels, func(a EXRChannel, b EXRChannel) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	for _, ch := range channels {
+		if len(ch.Data) != width*height {
+			return fmt.Errorf("exr channel %s has %d values, expected %d", ch.Name, len(ch.Data), width*height)
+		}
+	}
+
+	header := &bytes.Buffer{}
+	writeEXRHeader(header, width, height, channels, compression)
+
+	lines := compression.linesPerBlock()
+	blocks := (height + lines - 1) / lines
+	chunks := make([][]byte, blocks)
+	for b := range blocks {
+		y0 := b * lines
+		y1 := min(y0+lines, height)
+		chunk, err := compressEXRBlock(packEXRBlock(width, y0, y1, channels), compression)
+		if err != nil {
+			return err
+		}
+		chunks[b] = chunk
+	}
+
+	out := bufio.NewWriter(w)
+	if _, err := out.Write(header.Bytes()); err != nil {
+		return err
+	}
+	// offset table, then every chunk prefixed by its first line and size
+	offset := uint64(header.Len() + 8*blocks)
+	for _, chunk := range chunks {
+		if err := binary.Write(out, binary.LittleEndian, offset); err != nil {
+			return err
+		}
+		offset += uint64(8 + len(chunk))
+	}
+	for b, chunk := range chunks {
+		if err := binary.Write(out, binary.LittleEndian, [2]int32{int32(b * lines), int32(len(chunk))}); err != nil {
+			return err
+		}
+		if _, err := out.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+func writeEXRHeader(buf *bytes.Buffer, width int, height int, channels []EXRChannel, compression EXRCompression) {
+	le := binary.LittleEndian
+	buf.Write(le.AppendUint32(nil, exrMagic))
+	buf.Write(le.AppendUint32(nil, exrVersion))
+
+	attribute := func(name string, kind string, value []byte) {
+		buf.WriteString(name)
+		buf.WriteByte(0)
+		buf.WriteString(kind)
+		buf.WriteByte(0)
+		buf.Write(le.AppendUint32(nil, uint32(len(value))))
+		buf.Write(value)
+	}
+
+	var chlist []byte
+	for _, ch := range channels {
+		chlist = append(chlist, ch.Name...)
+		chlist = append(chlist, 0)
+		chlist = le.AppendUint32(chlist, exrPixelFloat)
+		// pLinear and three reserved bytes
+		chlist = append(chlist, 0, 0, 0, 0)
+		chlist = le.AppendUint32(chlist, 1)
+		chlist = le.AppendUint32(chlist, 1)
+	}
+	chlist = append(chlist, 0)
+
+	var window []byte
+	for _, v := range []int32{0, 0, int32(width - 1), int32(height - 1)} {
+		window = le.AppendUint32(window, uint32(v))
+	}
+	float := func(values ...float32) []byte {
+		var b []byte
+		for _, v := range values {
+			b = le.AppendUint32(b, math.Float32bits(v))
+		}
+		return b
+	}
+
+	attribute("channels", "chlist", chlist)
+	attribute("compression", "compression", []byte{byte(compression)})
+	attribute("dataWindow", "box2i", window)
+	attribute("displayWindow", "box2i", window)
+	attribute("lineOrder", "lineOrder", []byte{0})
+	attribute("pixelAspectRatio", "float", float(1))
+	attribute("screenWindowCenter", "v2f", float(0, 0))
+	attribute("screenWindowWidth", "float", float(1))
+	buf.WriteByte(0)
+}
+
+// packEXRBlock lays out lines y0 to y1, each line holding every channel
+// one after the other.
+func packEXRBlock(width int, y0 int, y1 int, channels []EXRChannel) []byte {
+	data := make([]byte, 0, (y1-y0)*width*len(channels)*4)
+	for y := y0; y < y1; y++ {
+		for _, ch := range channels {
+			for _, v := range ch.Data[y*width : (y+1)*width] {
+				data = binary.LittleEndian.AppendUint32(data, math.Float32bits(v))
+			}
+		}
+	}
+	return data
+}
+
+// compressEXRBlock falls back to the raw data when compressing doesn't make
+// it smaller, readers detect that from the chunk size.
+func compressEXRBlock(raw []byte, compression EXRCompression) ([]byte, error) {
+	var packed []byte
+	switch compression {
+	case EXRNone:
+		return raw, nil
+	case EXRRLE:
+		packed = rleCompress(exrPredict(raw))
+	case EXRZIPS, EXRZIP:
+		buf := &bytes.Buffer{}
+		zw := zlib.NewWriter(buf)
+		if _, err := zw.Write(exrPredict(raw)); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		packed = buf.Bytes()
+	}
+	if len(packed) >= len(raw) {
+		return raw, nil
+	}
+	return packed, nil
+}
+
+// exrPredict splits the bytes into even and odd halves and delta encodes
+// them, the preprocessing OpenEXR applies before RLE and ZIP.
+func exrPredict(raw []byte) []byte {
+	tmp := make([]byte, len(raw))
+	half := (len(raw) + 1) / 2
+	for i, b := range raw {
+		if i%2 == 0 {
+			tmp[i/2] = b
+		} else {
+			tmp[half+i/2] = b
+		}
+	}
+	prev := 0
+	for i := range tmp {
+		cur := int(tmp[i])
+		if i > 0 {
+			tmp[i] = byte(cur - prev + 128 + 256)
+		}
+		prev = cur
+	}
+	return tmp
+}
+
+func rleCompress(in []byte) []byte {
+	const (
+		minRunLength = 3
+		maxRunLength = 127
+	)
+	out := make([]byte, 0, len(in))
+	n := len(in)
+	runStart, runEnd := 0, 1
+	for runStart < n {
+		for runEnd < n && in[runStart] == in[runEnd] && runEnd-runStart-1 < maxRunLength {
+			runEnd++
+		}
+		if runEnd-runStart >= minRunLength {
+			// a run is stored as its length minus one followed by the byte
+			out = append(out, byte(runEnd-runStart-1), in[runStart])
+			runStart = runEnd
+		} else {
+			// literals are stored as their negated count followed by the bytes
+			for runEnd < n &&
+				((runEnd+1 >= n || in[runEnd] != in[runEnd+1]) || (runEnd+2 >= n || in[runEnd+1] != in[runEnd+2])) &&
+				runEnd-runStart < maxRunLength {
+				runEnd++
+			}
+			out = append(out, byte(int8(runStart-runEnd)))
+			out = append(out, in[runStart:runEnd]...)
+			runStart = runEnd
+		}
+		runEnd++
+	}
+	return out
+}
@@ -0,0 +1,65 @@
+package imageio
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadFile decodes a .hdr or .pfm image.
+func ReadFile(path string) (*FloatImage, error) {
+	var decode func(io.Reader) (*FloatImage, error)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".hdr":
+		decode = DecodeHDR
+	case ".pfm":
+		decode = DecodePFM
+	default:
+		return nil, fmt.Errorf("%s: unsupported HDR format, expected .hdr or .pfm", path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, err := decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return img, nil
+}
+
+// WriteFile encodes img in the format matching the extension of path: .exr
+// (using compression), .hdr or .pfm.
+func WriteFile(path string, img *FloatImage, compression EXRCompression) error {
+	var encode func(io.Writer, *FloatImage) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".exr":
+		encode = func(w io.Writer, img *FloatImage) error {
+			return EncodeEXR(w, img, compression)
+		}
+	case ".hdr":
+		encode = EncodeHDR
+	case ".pfm":
+		encode = EncodePFM
+	default:
+		return fmt.Errorf("%s: unsupported HDR format, expected .exr, .hdr or .pfm", path)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// IsHDRFile reports whether path has an extension ReadFile can decode.
+func IsHDRFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".hdr" || ext == ".pfm"
+}
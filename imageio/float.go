@@ -0,0 +1,41 @@
+package imageio
+
+// FloatImage is a linear, high dynamic range image with four float32
+// channels (RGBA) per pixel stored row by row from the top.
+type FloatImage struct {
+	Width  int
+	Height int
+	Pix    []float32
+}
+
+func NewFloatImage(width int, height int) *FloatImage {
+	return &FloatImage{Width: width, Height: height, Pix: make([]float32, 4*width*height)}
+}
+
+func (img *FloatImage) offset(x int, y int) int {
+	return 4 * (y*img.Width + x)
+}
+
+func (img *FloatImage) At(x int, y int) [4]float32 {
+	i := img.offset(x, y)
+	return [4]float32{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}
+}
+
+func (img *FloatImage) Set(x int, y int, c [4]float32) {
+	i := img.offset(x, y)
+	copy(img.Pix[i:i+4], c[:])
+}
+
+// SetRGB stores an opaque color.
+func (img *FloatImage) SetRGB(x int, y int, r float64, g float64, b float64) {
+	img.Set(x, y, [4]float32{float32(r), float32(g), float32(b), 1})
+}
+
+// Channel extracts channel c (0 for R through 3 for A) as a plane.
+func (img *FloatImage) Channel(c int) []float32 {
+	plane := make([]float32, img.Width*img.Height)
+	for i := range plane {
+		plane[i] = img.Pix[4*i+c]
+	}
+	return plane
+}
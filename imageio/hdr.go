@@ -0,0 +1,203 @@
+package imageio
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+var errHDRFormat = errors.New("hdr: invalid format")
+
+// EncodeHDR writes img as a Radiance RGBE file with run length encoded
+// scanlines, alpha is dropped.
+func EncodeHDR(w io.Writer, img *FloatImage) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", img.Height, img.Width)
+	scanline := make([]byte, 4*img.Width)
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			c := img.At(x, y)
+			rgbe := toRGBE(c[0], c[1], c[2])
+			copy(scanline[4*x:], rgbe[:])
+		}
+		if err := writeHDRScanline(bw, scanline, img.Width); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func toRGBE(r float32, g float32, b float32) [4]byte {
+	r, g, b = max(r, 0), max(g, 0), max(b, 0)
+	v := max(r, g, b)
+	if v < 1e-32 {
+		return [4]byte{}
+	}
+	frac, exp := math.Frexp(float64(v))
+	scale := float32(frac * 256 / float64(v))
+	return [4]byte{byte(r * scale), byte(g * scale), byte(b * scale), byte(exp + 128)}
+}
+
+func fromRGBE(rgbe []byte) (float32, float32, float32) {
+	if rgbe[3] == 0 {
+		return 0, 0, 0
+	}
+	// texel values are stored truncated, reading back the center of the
+	// quantization step halves the error
+	f := float32(math.Ldexp(1, int(rgbe[3])-(128+8)))
+	return (float32(rgbe[0]) + 0.5) * f, (float32(rgbe[1]) + 0.5) * f, (float32(rgbe[2]) + 0.5) * f
+}
+
+// writeHDRScanline stores each of the four components as its own run length
+// encoded stream, widths the adaptive encoding cannot describe are written
+// flat.
+func writeHDRScanline(w *bufio.Writer, scanline []byte, width int) error {
+	if width < 8 || width > 0x7fff {
+		_, err := w.Write(scanline)
+		return err
+	}
+	w.Write([]byte{2, 2, byte(width >> 8), byte(width)})
+	component := make([]byte, width)
+	for c := range 4 {
+		for x := range width {
+			component[x] = scanline[4*x+c]
+		}
+		writeHDRRuns(w, component)
+	}
+	return nil
+}
+
+func writeHDRRuns(w *bufio.Writer, data []byte) {
+	const minRun = 4
+	i := 0
+	for i < len(data) {
+		// find the next run long enough to be worth encoding
+		start := i
+		run := 1
+		for start < len(data) {
+			run = 1
+			for start+run < len(data) && run < 127 && data[start+run] == data[start] {
+				run++
+			}
+			if run >= minRun {
+				break
+			}
+			start += run
+		}
+		for i < start {
+			n := min(start-i, 128)
+			w.WriteByte(byte(n))
+			w.Write(data[i : i+n])
+			i += n
+		}
+		if start < len(data) {
+			w.WriteByte(byte(128 + run))
+			w.WriteByte(data[start])
+			i = start + run
+		}
+	}
+}
+
+// DecodeHDR reads a Radiance RGBE file in either the flat or the run length
+// encoded layout, images stored bottom up are flipped.
+func DecodeHDR(r io.Reader) (*FloatImage, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.ReadString('\n')
+	if err != nil || !strings.HasPrefix(magic, "#?") {
+		return nil, fmt.Errorf("%w: missing #? signature", errHDRFormat)
+	}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("%w: truncated header", errHDRFormat)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if format, ok := strings.CutPrefix(line, "FORMAT="); ok && format != "32-bit_rle_rgbe" {
+			return nil, fmt.Errorf("hdr: unsupported format %s", format)
+		}
+	}
+	resolution, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing resolution", errHDRFormat)
+	}
+	var ySign, xSign byte
+	var width, height int
+	if _, err := fmt.Sscanf(resolution, "%cY %d %cX %d", &ySign, &height, &xSign, &width); err != nil || xSign != '+' {
+		return nil, fmt.Errorf("hdr: unsupported resolution %q", strings.TrimSpace(resolution))
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("%w: image size %dx%d", errHDRFormat, width, height)
+	}
+
+	img := NewFloatImage(width, height)
+	scanline := make([]byte, 4*width)
+	for row := range height {
+		if err := readHDRScanline(br, scanline, width); err != nil {
+			return nil, err
+		}
+		y := row
+		if ySign == '+' {
+			y = height - 1 - row
+		}
+		for x := range width {
+			r, g, b := fromRGBE(scanline[4*x:])
+			img.SetRGB(x, y, float64(r), float64(g), float64(b))
+		}
+	}
+	return img, nil
+}
+
+func readHDRScanline(r *bufio.Reader, scanline []byte, width int) error {
+	if _, err := io.ReadFull(r, scanline[:4]); err != nil {
+		return err
+	}
+	if width < 8 || width > 0x7fff || scanline[0] != 2 || scanline[1] != 2 || scanline[2]&0x80 != 0 {
+		_, err := io.ReadFull(r, scanline[4:])
+		return err
+	}
+	if int(scanline[2])<<8|int(scanline[3]) != width {
+		return fmt.Errorf("%w: scanline width mismatch", errHDRFormat)
+	}
+	for c := range 4 {
+		for x := 0; x < width; {
+			count, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			if count > 128 {
+				n := int(count - 128)
+				value, err := r.ReadByte()
+				if err != nil {
+					return err
+				}
+				if x+n > width {
+					return fmt.Errorf("%w: run overflows scanline", errHDRFormat)
+				}
+				for ; n > 0; n-- {
+					scanline[4*x+c] = value
+					x++
+				}
+			} else {
+				n := int(count)
+				if n == 0 || x+n > width {
+					return fmt.Errorf("%w: bad literal run", errHDRFormat)
+				}
+				for ; n > 0; n-- {
+					value, err := r.ReadByte()
+					if err != nil {
+						return err
+					}
+					scanline[4*x+c] = value
+					x++
+				}
+			}
+		}
+	}
+	return nil
+}
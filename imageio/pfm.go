@@ -0,0 +1,104 @@
+package imageio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+var errPFMFormat = errors.New("pfm: invalid format")
+
+// EncodePFM writes img as a little endian color Portable Float Map, alpha
+// is dropped. PFM stores rows bottom up.
+func EncodePFM(w io.Writer, img *FloatImage) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "PF\n%d %d\n-1.0\n", img.Width, img.Height)
+	row := make([]byte, 12*img.Width)
+	for y := img.Height - 1; y >= 0; y-- {
+		for x := 0; x < img.Width; x++ {
+			c := img.At(x, y)
+			for i := range 3 {
+				binary.LittleEndian.PutUint32(row[12*x+4*i:], math.Float32bits(c[i]))
+			}
+		}
+		bw.Write(row)
+	}
+	return bw.Flush()
+}
+
+// DecodePFM reads color (PF) and grayscale (Pf) Portable Float Maps of
+// either byte order, grayscale is replicated into all three channels.
+func DecodePFM(r io.Reader) (*FloatImage, error) {
+	br := bufio.NewReader(r)
+	tokens := make([]string, 4)
+	for i := range tokens {
+		token, err := pfmToken(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: truncated header", errPFMFormat)
+		}
+		tokens[i] = token
+	}
+	var channels int
+	switch tokens[0] {
+	case "PF":
+		channels = 3
+	case "Pf":
+		channels = 1
+	default:
+		return nil, fmt.Errorf("%w: unknown signature %q", errPFMFormat, tokens[0])
+	}
+	width, err1 := strconv.Atoi(tokens[1])
+	height, err2 := strconv.Atoi(tokens[2])
+	scale, err3 := strconv.ParseFloat(tokens[3], 64)
+	if err := errors.Join(err1, err2, err3); err != nil || width <= 0 || height <= 0 || scale == 0 {
+		return nil, fmt.Errorf("%w: bad header %v", errPFMFormat, tokens[1:])
+	}
+	// a negative scale marks little endian data
+	var order binary.ByteOrder = binary.BigEndian
+	if scale < 0 {
+		order = binary.LittleEndian
+	}
+
+	img := NewFloatImage(width, height)
+	row := make([]byte, 4*channels*width)
+	for y := height - 1; y >= 0; y-- {
+		if _, err := io.ReadFull(br, row); err != nil {
+			return nil, fmt.Errorf("pfm: reading pixels: %w", err)
+		}
+		for x := range width {
+			var c [3]float32
+			for i := range channels {
+				c[i] = math.Float32frombits(order.Uint32(row[4*(channels*x+i):]))
+			}
+			if channels == 1 {
+				c[1], c[2] = c[0], c[0]
+			}
+			img.Set(x, y, [4]float32{c[0], c[1], c[2], 1})
+		}
+	}
+	return img, nil
+}
+
+// pfmToken reads a whitespace separated header field, exactly one
+// whitespace byte after the last field separates it from the pixel data.
+func pfmToken(r *bufio.Reader) (string, error) {
+	var token []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch b {
+		case ' ', '\t', '\n', '\r':
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		default:
+			token = append(token, b)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package math3
+
+import "math"
+
+type AABB struct {
+	X Interval
+	Y Interval
+	Z Interval
+}
+
+var EmptyAABB = AABB{X: EmptyInterval, Y: EmptyInterval, Z: EmptyInterval}
+
+func NewAABB(a Vec3, b Vec3) AABB {
+	return AABB{
+		X: Interval{Min: math.Min(a[0], b[0]), Max: math.Max(a[0], b[0])},
+		Y: Interval{Min: math.Min(a[1], b[1]), Max: math.Max(a[1], b[1])},
+		Z: Interval{Min: math.Min(a[2], b[2]), Max: math.Max(a[2], b[2])},
+	}
+}
+
+func (box AABB) Axis(n int) Interval {
+	switch n {
+	case 1:
+		return box.Y
+	case 2:
+		return box.Z
+	default:
+		return box.X
+	}
+}
+
+func (box AABB) Min() Vec3 {
+	return Vec3{box.X.Min, box.Y.Min, box.Z.Min}
+}
+
+func (box AABB) Max() Vec3 {
+	return Vec3{box.X.Max, box.Y.Max, box.Z.Max}
+}
+
+func (box AABB) IsEmpty() bool {
+	return box.X.Size() < 0 || box.Y.Size() < 0 || box.Z.Size() < 0
+}
+
+func (box AABB) Union(other AABB) AABB {
+	return AABB{
+		X: box.X.Union(other.X),
+		Y: box.Y.Union(other.Y),
+		Z: box.Z.Union(other.Z),
+	}
+}
+
+func (box AABB) Extend(p Vec3) AABB {
+	return box.Union(AABB{
+		X: Interval{Min: p[0], Max: p[0]},
+		Y: Interval{Min: p[1], Max: p[1]},
+		Z: Interval{Min: p[2], Max: p[2]},
+	})
+}
+
+// Pad grows degenerate axes to at least delta so flat primitives (e.g.
+// axis aligned triangles) still produce a box rays can hit.
+func (box AABB) Pad(delta float64) AABB {
+	pad := func(iv Interval) Interval {
+		if iv.Size() < delta {
+			return iv.Expand(delta)
+		}
+		return iv
+	}
+	return AABB{X: pad(box.X), Y: pad(box.Y), Z: pad(box.Z)}
+}
+
+func (box AABB) Centroid() Vec3 {
+	return Vec3{
+		(box.X.Min + box.X.Max) / 2,
+		(box.Y.Min + box.Y.Max) / 2,
+		(box.Z.Min + box.Z.Max) / 2,
+	}
+}
+
+func (box AABB) SurfaceArea() float64 {
+	if box.IsEmpty() {
+		return 0
+	}
+	dx, dy, dz := box.X.Size(), box.Y.Size(), box.Z.Size()
+	return 2 * (dx*dy + dy*dz + dz*dx)
+}
+
+func (box AABB) LongestAxis() int {
+	dx, dy, dz := box.X.Size(), box.Y.Size(), box.Z.Size()
+	switch {
+	case dx >= dy && dx >= dz:
+		return 0
+	case dy >= dz:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (box AABB) Hit(ray Ray, rayT Interval) bool {
+	return box.HitInv(ray.Origin, ray.InvDirection(), rayT)
+}
+
+// HitInv is the slab test with the reciprocal of the ray direction already
+// computed, so traversals can share it across every box they visit.
+func (box AABB) HitInv(origin Vec3, invDir Vec3, rayT Interval) bool {
+	tMin, tMax := rayT.Min, rayT.Max
+	tMin, tMax = slab(box.X, origin[0], invDir[0], tMin, tMax)
+	tMin, tMax = slab(box.Y, origin[1], invDir[1], tMin, tMax)
+	tMin, tMax = slab(box.Z, origin[2], invDir[2], tMin, tMax)
+	return tMin <= tMax
+}
+
+// slab clips [tMin, tMax] to one axis of a box. A ray parallel to the axis
+// starting on one of its planes gives 0*Inf = NaN, the comparisons are
+// ordered so NaN leaves the range unchanged rather than rejecting the box.
+func slab(iv Interval, origin, invDir, tMin, tMax float64) (float64, float64) {
+	t0 := (iv.Min - origin) * invDir
+	t1 := (iv.Max - origin) * invDir
+	if t0 > t1 {
+		t0, t1 = t1, t0
+	}
+	if t0 > tMin {
+		tMin = t0
+	}
+	if t1 < tMax {
+		tMax = t1
+	}
+	return tMin, tMax
+}
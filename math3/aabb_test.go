@@ -0,0 +1,31 @@
+package math3
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAABBHit(t *testing.T) {
+	box := NewAABB(Vec3{1, 0, -1}, Vec3{2, 1, 1})
+	forward := Interval{Min: 0, Max: math.Inf(1)}
+	tests := []struct {
+		name string
+		ray  Ray
+		want bool
+	}{
+		{"through the middle", Ray{Origin: Vec3{0, 0.5, 0}, Direction: Vec3{1, 0, 0}}, true},
+		{"pointing away", Ray{Origin: Vec3{0, 0.5, 0}, Direction: Vec3{-1, 0, 0}}, false},
+		{"passing beside", Ray{Origin: Vec3{0, 2, 0}, Direction: Vec3{1, 0, 0}}, false},
+		{"starting inside", Ray{Origin: Vec3{1.5, 0.5, 0}, Direction: Vec3{0, 1, 1}}, true},
+		// a zero direction component with the origin on that axis's slab
+		// plane gives 0*Inf = NaN in the slab test
+		{"parallel on the bottom face", Ray{Origin: Vec3{0, 0, 0}, Direction: Vec3{1, 0, 0}}, true},
+		{"parallel on an edge", Ray{Origin: Vec3{0, 1, 1}, Direction: Vec3{1, 0, 0}}, true},
+		{"on a face plane outside the box", Ray{Origin: Vec3{0, 0, 2}, Direction: Vec3{1, 0, 0}}, false},
+	}
+	for _, test := range tests {
+		if got := box.Hit(test.ray, forward); got != test.want {
+			t.Errorf("%s: Hit = %v, expected %v", test.name, got, test.want)
+		}
+	}
+}
@@ -1,4 +1,4 @@
-package raytracer
+package math3
 
 import "math"
 
@@ -33,3 +33,12 @@ func (iv Interval) Clamp(v float64) float64 {
 	}
 	return v
 }
+
+func (iv Interval) Union(other Interval) Interval {
+	return Interval{Min: math.Min(iv.Min, other.Min), Max: math.Max(iv.Max, other.Max)}
+}
+
+func (iv Interval) Expand(delta float64) Interval {
+	padding := delta / 2
+	return Interval{Min: iv.Min - padding, Max: iv.Max + padding}
+}
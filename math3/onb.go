@@ -0,0 +1,25 @@
+package math3
+
+import "math"
+
+// ONB is an orthonormal basis whose W axis is aligned with a given vector.
+type ONB struct {
+	U Vec3
+	V Vec3
+	W Vec3
+}
+
+func NewONB(n Vec3) ONB {
+	w := n.Normalize()
+	a := Vec3{1, 0, 0}
+	if math.Abs(w.X()) > 0.9 {
+		a = Vec3{0, 1, 0}
+	}
+	v := Cross(w, a).Normalize()
+	u := Cross(w, v)
+	return ONB{U: u, V: v, W: w}
+}
+
+func (o ONB) Transform(v Vec3) Vec3 {
+	return o.U.Scale(v[0]).Add(o.V.Scale(v[1])).Add(o.W.Scale(v[2]))
+}
@@ -8,3 +8,7 @@ type Ray struct {
 func (ray Ray) At(t float64) Vec3 {
 	return ray.Origin.Add(ray.Direction.Scale(t))
 }
+
+func (ray Ray) InvDirection() Vec3 {
+	return Vec3{1 / ray.Direction[0], 1 / ray.Direction[1], 1 / ray.Direction[2]}
+}
@@ -0,0 +1,50 @@
+package math3
+
+import "math/rand/v2"
+
+// Sampler is the random number generator of a single camera sample. Seeding
+// it from the render seed, the pixel and the sample index makes renders
+// reproducible no matter which goroutine takes which sample, and avoids
+// contention on a shared source.
+type Sampler struct {
+	pcg rand.PCG
+}
+
+func NewSampler(keys ...uint64) *Sampler {
+	s := &Sampler{}
+	s.Seed(keys...)
+	return s
+}
+
+// Seed restarts the sampler on the sequence identified by keys, keys that
+// differ in any bit give unrelated sequences.
+func (s *Sampler) Seed(keys ...uint64) {
+	h := uint64(0x9e3779b97f4a7c15)
+	for _, k := range keys {
+		h = mix64(h ^ k)
+	}
+	s.pcg.Seed(h, mix64(h))
+}
+
+func (s *Sampler) Uint64() uint64 {
+	return s.pcg.Uint64()
+}
+
+// Float64 returns a number in [0, 1).
+func (s *Sampler) Float64() float64 {
+	return float64(s.pcg.Uint64()>>11) / (1 << 53)
+}
+
+// IntN returns a number in [0, n), n must be below 2^32.
+func (s *Sampler) IntN(n int) int {
+	return int((s.pcg.Uint64() >> 32) * uint64(n) >> 32)
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
@@ -2,7 +2,6 @@ package math3
 
 import (
 	"math"
-	"math/rand/v2"
 )
 
 func Deg2Rad(deg float64) float64 {
@@ -17,21 +16,21 @@ func Reflect(v Vec3, n Vec3) Vec3 {
 	return v.Sub(n.Scale(v.Dot(n) * 2))
 }
 
-func Random() Vec3 {
-	return Vec3{rand.Float64(), rand.Float64(), rand.Float64()}
+func Random(s *Sampler) Vec3 {
+	return Vec3{s.Float64(), s.Float64(), s.Float64()}
 }
 
-func RandomBetween(low float64, high float64) Vec3 {
+func RandomBetween(s *Sampler, low float64, high float64) Vec3 {
 	return Vec3{
-		low + (high-low)*rand.Float64(),
-		low + (high-low)*rand.Float64(),
-		low + (high-low)*rand.Float64(),
+		low + (high-low)*s.Float64(),
+		low + (high-low)*s.Float64(),
+		low + (high-low)*s.Float64(),
 	}
 }
 
-func RandomUnitVector() Vec3 {
+func RandomUnitVector(s *Sampler) Vec3 {
 	for {
-		p := RandomBetween(-1, 1)
+		p := RandomBetween(s, -1, 1)
 		lensq := p.LengthSquared()
 		if 1e-160 < lensq && lensq <= 1.0 {
 			return p.Div(math.Sqrt(lensq))
@@ -39,17 +38,17 @@ func RandomUnitVector() Vec3 {
 	}
 }
 
-func RandomOnHemisphere(normal Vec3) Vec3 {
-	onSphere := RandomUnitVector()
+func RandomOnHemisphere(s *Sampler, normal Vec3) Vec3 {
+	onSphere := RandomUnitVector(s)
 	if Dot(onSphere, normal) > 0 {
 		return onSphere
 	}
 	return onSphere.Scale(-1)
 }
 
-func RandomInUnitDisk() Vec3 {
+func RandomInUnitDisk(s *Sampler) Vec3 {
 	for {
-		p := RandomBetween(-1, 1)
+		p := RandomBetween(s, -1, 1)
 		p[2] = 0
 		if p.LengthSquared() < 1 {
 			return p
@@ -57,6 +56,27 @@ func RandomInUnitDisk() Vec3 {
 	}
 }
 
+// RandomCosineDirection returns a direction around +Z distributed
+// proportionally to the cosine of its angle with the axis.
+func RandomCosineDirection(s *Sampler) Vec3 {
+	r1, r2 := s.Float64(), s.Float64()
+	phi := 2 * math.Pi * r1
+	x := math.Cos(phi) * math.Sqrt(r2)
+	y := math.Sin(phi) * math.Sqrt(r2)
+	return Vec3{x, y, math.Sqrt(1 - r2)}
+}
+
+// RandomToSphere returns a direction around +Z uniformly distributed over
+// the cone subtended by a sphere of the given radius at distance sqrt(distSq).
+func RandomToSphere(s *Sampler, radius float64, distSq float64) Vec3 {
+	r1, r2 := s.Float64(), s.Float64()
+	cosThetaMax := math.Sqrt(math.Max(0, 1-radius*radius/distSq))
+	z := 1 + r2*(cosThetaMax-1)
+	phi := 2 * math.Pi * r1
+	sinTheta := math.Sqrt(math.Max(0, 1-z*z))
+	return Vec3{math.Cos(phi) * sinTheta, math.Sin(phi) * sinTheta, z}
+}
+
 func Refract(uv Vec3, n Vec3, etaiOverEtat float64) Vec3 {
 	cosT := math.Min(Dot(uv.Scale(-1), n), 1.0)
 	rOutPerp := uv.Add(n.Scale(cosT)).Scale(etaiOverEtat)
@@ -0,0 +1,272 @@
+// Package preview renders a scene progressively while serving the current
+// estimate and the render's progress over HTTP.
+package preview
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"raytracer/raytracer"
+	"raytracer/scene"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultFrameInterval = time.Second
+
+// Server owns the render of one scene, Start must be called before serving.
+// The world is built once, restarts only change the camera.
+type Server struct {
+	doc        *scene.Scene
+	world      *raytracer.World
+	toneMapper raytracer.ToneMapper
+	// every render is cancelled when ctx is done
+	ctx     context.Context
+	mu      sync.Mutex
+	current *render
+	renders int
+}
+
+type render struct {
+	id          int
+	camera      scene.Camera
+	progressive *raytracer.Progressive
+	cancel      context.CancelFunc
+	// closed once Run returns and state is final
+	done     chan struct{}
+	mu       sync.Mutex
+	progress raytracer.ProgressEvent
+	start    time.Time
+	state    string
+	err      error
+}
+
+// Status is the state of the current render as served by /status, Pass and
+// the counts after it describe the tiles of the pass in progress.
+type Status struct {
+	ID          int          `json:"id"`
+	State       string       `json:"state"`
+	Error       string       `json:"error,omitempty"`
+	Camera      scene.Camera `json:"camera"`
+	PassesDone  int          `json:"passesDone"`
+	Pass        int          `json:"pass"`
+	TilesDone   int          `json:"tilesDone"`
+	TilesTotal  int          `json:"tilesTotal"`
+	PixelsDone  int          `json:"pixelsDone"`
+	PixelsTotal int          `json:"pixelsTotal"`
+	Samples     int64        `json:"samples"`
+	// seconds since the render started and until the pass ends
+	Elapsed float64 `json:"elapsed"`
+	PassETA float64 `json:"passEta"`
+}
+
+func New(ctx context.Context, doc *scene.Scene, world *raytracer.World, toneMapper raytracer.ToneMapper) *Server {
+	return &Server{ctx: ctx, doc: doc, world: world, toneMapper: toneMapper}
+}
+
+// Start cancels the current render, waits for it to stop and starts
+// rendering the scene through camera.
+func (s *Server) Start(camera scene.Camera) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc := *s.doc
+	doc.Camera = camera
+	params, err := doc.CameraParams()
+	if err != nil {
+		return err
+	}
+	opts, err := doc.RenderOptions()
+	if err != nil {
+		return err
+	}
+	if s.current != nil {
+		s.current.cancel()
+		<-s.current.done
+	}
+	s.doc.Camera = camera
+	s.renders++
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	r := &render{id: s.renders, camera: camera, cancel: cancel, done: make(chan struct{}), start: time.Now(), state: "rendering"}
+	opts.Progress = func(event raytracer.ProgressEvent) {
+		r.mu.Lock()
+		r.progress = event
+		r.mu.Unlock()
+	}
+	r.progressive = raytracer.NewCamera(params).NewProgressive(s.world, opts)
+	s.current = r
+	go func() {
+		defer close(r.done)
+		_, err := r.progressive.Run(ctx)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		switch {
+		case errors.Is(err, context.Canceled):
+			r.state = "cancelled"
+		case err != nil:
+			r.state, r.err = "failed", err
+		default:
+			r.state = "done"
+		}
+	}()
+	return nil
+}
+
+// Cancel stops the current render, keeping its image, and waits for it.
+func (s *Server) Cancel() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil {
+		s.current.cancel()
+		<-s.current.done
+	}
+}
+
+func (s *Server) render() *render {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+func (s *Server) Status() Status {
+	r := s.render()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := Status{
+		ID:          r.id,
+		State:       r.state,
+		Camera:      r.camera,
+		PassesDone:  r.progressive.Passes(),
+		Pass:        r.progress.Pass,
+		TilesDone:   r.progress.TilesDone,
+		TilesTotal:  r.progress.TilesTotal,
+		PixelsDone:  r.progress.PixelsDone,
+		PixelsTotal: r.progress.PixelsTotal,
+		Samples:     r.progress.Samples,
+		Elapsed:     time.Since(r.start).Seconds(),
+		PassETA:     r.progress.ETA.Seconds(),
+	}
+	if r.err != nil {
+		status.Error = r.err.Error()
+	}
+	return status
+}
+
+// Handler serves:
+//
+//	GET  /           a page showing the stream and the status
+//	GET  /image.png  the current estimate
+//	GET  /stream     MJPEG of the current estimate, every ?interval= seconds
+//	GET  /status     Status as JSON
+//	POST /cancel     stop the render
+//	POST /restart    render again, with the camera fields in the JSON body
+//	                 replacing the current ones
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	})
+	mux.HandleFunc("GET /image.png", s.serveImage)
+	mux.HandleFunc("GET /stream", s.serveStream)
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Status())
+	})
+	mux.HandleFunc("POST /cancel", func(w http.ResponseWriter, r *http.Request) {
+		s.Cancel()
+		writeJSON(w, http.StatusOK, s.Status())
+	})
+	mux.HandleFunc("POST /restart", s.serveRestart)
+	return mux
+}
+
+func (s *Server) serveImage(w http.ResponseWriter, r *http.Request) {
+	img := raytracer.ToRGBA(s.toneMapper.Apply(s.render().progressive.Snapshot()), raytracer.DitherNone)
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	png.Encode(w, img)
+}
+
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request) {
+	interval := defaultFrameInterval
+	if v := r.URL.Query().Get("interval"); v != "" {
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err != nil || seconds <= 0 {
+			http.Error(w, "interval must be a positive number of seconds", http.StatusBadRequest)
+			return
+		}
+		interval = time.Duration(seconds * float64(time.Second))
+	}
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mw.Boundary())
+	w.Header().Set("Cache-Control", "no-store")
+	rc := http.NewResponseController(w)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		img := raytracer.ToRGBA(s.toneMapper.Apply(s.render().progressive.Snapshot()), raytracer.DitherNone)
+		part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"image/jpeg"}})
+		if err != nil {
+			return
+		}
+		if err := jpeg.Encode(part, img, &jpeg.Options{Quality: 90}); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) serveRestart(w http.ResponseWriter, r *http.Request) {
+	camera := s.Status().Camera
+	if r.ContentLength != 0 {
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&camera); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := s.Start(camera); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Status())
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+const page = `<!doctype html>
+<title>Render preview</title>
+<style>body { font-family: sans-serif; } img { max-width: 100%; }</style>
+<img src="/stream">
+<p>
+<button onclick="fetch('/cancel', {method: 'POST'})">Cancel</button>
+<button onclick="fetch('/restart', {method: 'POST'})">Restart</button>
+</p>
+<pre id="status"></pre>
+<script>
+setInterval(async () => {
+	const status = await (await fetch('/status')).json();
+	document.getElementById('status').textContent = JSON.stringify(status, null, 2);
+}, 1000);
+</script>
+`
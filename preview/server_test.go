@@ -0,0 +1,100 @@
+package preview
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"raytracer/scene"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	doc := scene.New()
+	doc.Camera = scene.Camera{
+		Width:       16,
+		AspectRatio: 1,
+		// doesn't finish before the test cancels it
+		SamplesPerPixel: 1 << 20,
+		MaxDepth:        8,
+		VFov:            40,
+		LookFrom:        scene.Vector{0, 1, 5},
+		LookAt:          scene.Vector{0, 0, 0},
+		FocusDist:       5,
+	}
+	doc.Render = scene.Render{Seed: 1}
+	doc.Materials["red"] = scene.Material{Type: "lambertian", Albedo: scene.Vector{0.7, 0.1, 0.1}}
+	doc.Objects = []scene.Object{{Type: "sphere", Center: scene.Vector{0, 0, 0}, Radius: 0.5, Material: "red"}}
+	world, _, err := doc.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	toneMapper, err := doc.ToneMapper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := New(ctx, doc, world, toneMapper)
+	if err := s.Start(doc.Camera); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		s.Cancel()
+		cancel()
+	})
+	return ts
+}
+
+func request(t *testing.T, ts *httptest.Server, method string, path string, body string) Status {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s %s: %s", method, path, resp.Status)
+	}
+	status := Status{}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestServerControls(t *testing.T) {
+	ts := startServer(t)
+
+	status := request(t, ts, "GET", "/status", "")
+	if status.ID != 1 || status.State != "rendering" {
+		t.Fatalf("initial status %+v, expected render 1 in progress", status)
+	}
+
+	status = request(t, ts, "POST", "/cancel", "")
+	if status.ID != 1 || status.State != "cancelled" {
+		t.Errorf("status after /cancel %+v, expected render 1 cancelled", status)
+	}
+
+	// fields missing from the body keep their current values
+	status = request(t, ts, "POST", "/restart", `{"samplesPerPixel": 4}`)
+	if status.ID != 2 || status.Camera.SamplesPerPixel != 4 || status.Camera.Width != 16 {
+		t.Errorf("status after /restart %+v, expected render 2 at 4 samples per pixel and 16 pixels wide", status)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for status.State == "rendering" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		status = request(t, ts, "GET", "/status", "")
+	}
+	if status.State != "done" || status.PassesDone != 3 {
+		t.Errorf("restarted render ended %+v, expected done after 3 passes", status)
+	}
+}
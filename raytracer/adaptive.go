@@ -0,0 +1,35 @@
+package raytracer
+
+import "math"
+
+// AdaptiveSampling takes between MinSamples and MaxSamples samples per
+// pixel, stopping as soon as the pixel's noise falls below Threshold.
+type AdaptiveSampling struct {
+	// standard error of the pixel's luminance in display units, measured
+	// after a square root to approximate the perceptual response (0.004 is
+	// roughly one step of an 8-bit image)
+	Threshold  float64
+	MinSamples int
+	MaxSamples int
+}
+
+// convergence is checked every adaptiveBatch samples once MinSamples are in
+const adaptiveBatch = 8
+
+// converged reports whether sampling can stop after the samples in ps, it
+// only checks every adaptiveBatch samples.
+func (a *AdaptiveSampling) converged(ps pixelSamples) bool {
+	if (ps.Count-a.MinSamples)%adaptiveBatch != 0 {
+		return false
+	}
+	return a.belowThreshold(ps)
+}
+
+func (a *AdaptiveSampling) belowThreshold(ps pixelSamples) bool {
+	if ps.Count < max(a.MinSamples, 2) {
+		return false
+	}
+	mean := ps.LumSum / float64(ps.Count)
+	// d sqrt(L) = dL / (2 sqrt(L))
+	return math.Sqrt(ps.variance())/(2*math.Sqrt(max(mean, 1e-4))) < a.Threshold
+}
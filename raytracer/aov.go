@@ -0,0 +1,83 @@
+package raytracer
+
+import (
+	"fmt"
+	"raytracer/math3"
+)
+
+// AOV is an auxiliary output variable: data about the surface first hit by
+// each camera ray, rendered alongside the color.
+type AOV int
+
+const (
+	AOVAlbedo AOV = iota
+	// shading normal facing the camera
+	AOVNormal
+	// distance along the viewing direction
+	AOVDepth
+	AOVPosition
+	// HitRecord.MaterialID, numbering the materials of a scene from 1
+	AOVMaterialID
+	// index of the hit object in World.Objects plus one
+	AOVObjectID
+	// variance of the pixel's luminance estimate, from the spread of its
+	// samples
+	AOVVariance
+	// number of samples taken, varies with adaptive sampling
+	AOVSamples
+	aovCount
+)
+
+var aovNames = [aovCount]string{"albedo", "normal", "depth", "position", "material_id", "object_id", "variance", "samples"}
+
+func ParseAOV(s string) (AOV, error) {
+	for aov, name := range aovNames {
+		if s == name {
+			return AOV(aov), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown AOV %q", s)
+}
+
+func (a AOV) String() string {
+	if a < 0 || a >= aovCount {
+		return fmt.Sprintf("AOV(%d)", int(a))
+	}
+	return aovNames[a]
+}
+
+// Channels names the meaningful channels of the AOV's image, single channel
+// AOVs repeat their value in R, G and B. Alpha always holds the fraction of
+// the pixel's samples that hit a surface.
+func (a AOV) Channels() []string {
+	switch a {
+	case AOVAlbedo:
+		return []string{"R", "G", "B"}
+	case AOVNormal, AOVPosition:
+		return []string{"X", "Y", "Z"}
+	case AOVDepth:
+		return []string{"Z"}
+	case AOVVariance:
+		return []string{"Y"}
+	case AOVSamples:
+		return []string{"count"}
+	default:
+		return []string{"id"}
+	}
+}
+
+// surfaceAlbedo is the reflectance of the hit surface, emitters report
+// their emission clamped to one.
+func surfaceAlbedo(r math3.Ray, rec HitRecord, s *math3.Sampler) math3.Vec3 {
+	if rec.Material == nil {
+		return math3.Vec3{}
+	}
+	if srec, ok := rec.Material.Scatter(r, rec, s); ok {
+		return srec.Attenuation
+	}
+	if emitter, ok := rec.Material.(Emitter); ok {
+		e := emitter.Emitted(rec.U, rec.V, rec.P)
+		return math3.Vec3{min(e[0], 1), min(e[1], 1), min(e[2], 1)}
+	}
+	return math3.Vec3{}
+}
@@ -0,0 +1,181 @@
+package raytracer
+
+import (
+	"math"
+	"raytracer/imageio"
+)
+
+// AtrousParams configures AtrousFilter, the sigmas follow the SVGF paper.
+type AtrousParams struct {
+	// number of passes, the footprint doubles with each one
+	Iterations int
+	// luminance edge stopping in units of the local standard deviation
+	ColorSigma float64
+	// exponent applied to the cosine between normals
+	NormalSigma float64
+	// depth edge stopping relative to the local depth gradient
+	DepthSigma float64
+}
+
+var DefaultAtrousParams = AtrousParams{Iterations: 5, ColorSigma: 4, NormalSigma: 128, DepthSigma: 1}
+
+var atrousKernel = [5]float64{1.0 / 16, 1.0 / 4, 3.0 / 8, 1.0 / 4, 1.0 / 16}
+
+// AtrousFilter is the edge avoiding À-Trous wavelet filter of SVGF: a 5x5
+// B3 spline kernel is applied with growing holes between the taps, weighted
+// by how far neighbors are from the center in luminance (relative to the
+// variance AOV) and in the normal and depth AOVs. The variance is filtered
+// alongside the color so later passes get more permissive as noise drops.
+// Color is demodulated by albedo when the frame has it.
+func AtrousFilter(frame *Frame, params AtrousParams) *imageio.FloatImage {
+	features := newDenoiseFeatures(frame)
+	color := features.demodulate(frame.Color)
+	width, height := color.Width, color.Height
+	variance := make([]float64, width*height)
+	if v := frame.AOVs[AOVVariance]; v != nil {
+		for i := range variance {
+			variance[i] = float64(v.Pix[4*i])
+			if features.albedo != nil {
+				// the variance was measured before demodulation
+				a := features.modulation(4 * i)
+				l := luminance32(a[0], a[1], a[2])
+				variance[i] /= l * l
+			}
+		}
+	}
+	normals := make([][3]float64, width*height)
+	if features.normal != nil {
+		for i := range normals {
+			n := features.normal.Pix[4*i : 4*i+3]
+			length := math.Sqrt(float64(n[0]*n[0] + n[1]*n[1] + n[2]*n[2]))
+			if length > 0 {
+				normals[i] = [3]float64{float64(n[0]) / length, float64(n[1]) / length, float64(n[2]) / length}
+			}
+		}
+	}
+	depth, gradient := depthGradient(features.depth, width, height)
+
+	next := imageio.NewFloatImage(width, height)
+	nextVariance := make([]float64, width*height)
+	for iteration := range params.Iterations {
+		step := 1 << iteration
+		filtered := blurVariance(variance, width, height)
+		parallelRows(height, func(y int) {
+			for x := range width {
+				p := y*width + x
+				cp := color.Pix[4*p : 4*p+4]
+				lp := luminance32(cp[0], cp[1], cp[2])
+				colorScale := params.ColorSigma*math.Sqrt(filtered[p]) + 1e-6
+				var sum [4]float64
+				sumVariance, totalWeight := 0.0, 0.0
+				for ky := -2; ky <= 2; ky++ {
+					qy := y + ky*step
+					if qy < 0 || qy >= height {
+						continue
+					}
+					for kx := -2; kx <= 2; kx++ {
+						qx := x + kx*step
+						if qx < 0 || qx >= width {
+							continue
+						}
+						q := qy*width + qx
+						cq := color.Pix[4*q : 4*q+4]
+						w := atrousKernel[kx+2] * atrousKernel[ky+2]
+						if q != p {
+							exponent := math.Abs(lp-luminance32(cq[0], cq[1], cq[2])) / colorScale
+							if depth != nil {
+								expected := math.Abs(gradient[p][0]*float64(kx*step)) + math.Abs(gradient[p][1]*float64(ky*step))
+								exponent += math.Abs(depth[p]-depth[q]) / (params.DepthSigma*expected + 1e-6)
+							}
+							w *= math.Exp(-exponent)
+							if features.normal != nil {
+								w *= normalWeight(normals[p], normals[q], params.NormalSigma)
+							}
+						}
+						for c := range 4 {
+							sum[c] += w * float64(cq[c])
+						}
+						sumVariance += w * w * variance[q]
+						totalWeight += w
+					}
+				}
+				for c := range 4 {
+					next.Pix[4*p+c] = float32(sum[c] / totalWeight)
+				}
+				nextVariance[p] = sumVariance / (totalWeight * totalWeight)
+			}
+		})
+		color, next = next, color
+		variance, nextVariance = nextVariance, variance
+	}
+	features.remodulate(color)
+	return color
+}
+
+func luminance32(r float32, g float32, b float32) float64 {
+	return 0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b)
+}
+
+// normalWeight compares unit normals, background pixels without a normal
+// only match each other.
+func normalWeight(a [3]float64, b [3]float64, sigma float64) float64 {
+	aEmpty, bEmpty := a == [3]float64{}, b == [3]float64{}
+	if aEmpty || bEmpty {
+		if aEmpty == bEmpty {
+			return 1
+		}
+		return 0
+	}
+	return math.Pow(max(a[0]*b[0]+a[1]*b[1]+a[2]*b[2], 0), sigma)
+}
+
+// depthGradient returns the depth AOV and its screen space gradient from
+// central differences, nil if there is no depth AOV.
+func depthGradient(img *imageio.FloatImage, width int, height int) ([]float64, [][2]float64) {
+	if img == nil {
+		return nil, nil
+	}
+	depth := make([]float64, width*height)
+	for i := range depth {
+		depth[i] = float64(img.Pix[4*i])
+	}
+	gradient := make([][2]float64, width*height)
+	at := func(x int, y int) float64 {
+		return depth[min(max(y, 0), height-1)*width+min(max(x, 0), width-1)]
+	}
+	for y := range height {
+		for x := range width {
+			// one sided differences across depth discontinuities would be
+			// huge, take the smaller side
+			gx := min(math.Abs(at(x+1, y)-at(x, y)), math.Abs(at(x, y)-at(x-1, y)))
+			gy := min(math.Abs(at(x, y+1)-at(x, y)), math.Abs(at(x, y)-at(x, y-1)))
+			gradient[y*width+x] = [2]float64{gx, gy}
+		}
+	}
+	return depth, gradient
+}
+
+// blurVariance prefilters the variance with a 3x3 gaussian, single pixel
+// estimates are too noisy to drive the edge stopping.
+func blurVariance(variance []float64, width int, height int) []float64 {
+	kernel := [3]float64{0.25, 0.5, 0.25}
+	out := make([]float64, len(variance))
+	for y := range height {
+		for x := range width {
+			sum, total := 0.0, 0.0
+			for ky := -1; ky <= 1; ky++ {
+				for kx := -1; kx <= 1; kx++ {
+					qx, qy := x+kx, y+ky
+					if qx < 0 || qx >= width || qy < 0 || qy >= height {
+						continue
+					}
+					w := kernel[kx+1] * kernel[ky+1]
+					sum += w * variance[qy*width+qx]
+					total += w
+				}
+			}
+			out[y*width+x] = sum / total
+		}
+	}
+	return out
+}
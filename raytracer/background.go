@@ -0,0 +1,43 @@
+package raytracer
+
+import (
+	"math"
+	"raytracer/math3"
+)
+
+type Background interface {
+	Color(ray math3.Ray) math3.Vec3
+}
+
+// SkyGradient blends from white at the horizon to light blue straight up.
+type SkyGradient struct{}
+
+func (SkyGradient) Color(ray math3.Ray) math3.Vec3 {
+	d := ray.Direction.Normalize()
+	a := 0.5 * (d.Y() + 1.0)
+	return math3.Vec3{1.0, 1.0, 1.0}.Scale(1.0 - a).Add(math3.Vec3{0.5, 0.7, 1.0}.Scale(a))
+}
+
+type SolidBackground struct {
+	Radiance math3.Vec3
+}
+
+func (b SolidBackground) Color(ray math3.Ray) math3.Vec3 {
+	return b.Radiance
+}
+
+// EnvironmentMap surrounds the scene with an equirectangular (latitude
+// longitude) image, the center of the image faces +X and Rotation turns it
+// around the Y axis in degrees.
+type EnvironmentMap struct {
+	Texture  *ImageTexture
+	Rotation float64
+}
+
+func (e EnvironmentMap) Color(ray math3.Ray) math3.Vec3 {
+	d := ray.Direction.Normalize()
+	sin, cos := math.Sincos(math3.Deg2Rad(e.Rotation))
+	d = math3.Vec3{cos*d.X() - sin*d.Z(), d.Y(), sin*d.X() + cos*d.Z()}
+	u, v := sphereUV(d)
+	return e.Texture.sample(u, v, WrapRepeat, WrapClamp)
+}
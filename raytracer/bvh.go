@@ -0,0 +1,217 @@
+package raytracer
+
+import (
+	"cmp"
+	"raytracer/math3"
+	"slices"
+)
+
+const (
+	bvhBins        = 16
+	bvhMaxLeafSize = 4
+	// relative cost of visiting a node compared to testing a primitive
+	bvhTraversalCost = 0.125
+)
+
+type bvhPrimitive struct {
+	Box      math3.AABB
+	Centroid math3.Vec3
+	Object   Hittable
+	Index    int
+}
+
+// Nodes are stored depth first: the left child of an interior node always
+// follows its parent, Offset points to the right child.
+type bvhNode struct {
+	Box    math3.AABB
+	Offset int
+	Count  int
+	Axis   int
+}
+
+type BVH struct {
+	nodes   []bvhNode
+	objects []Hittable
+	// position of every leaf object in the slice the BVH was built from
+	indices []int
+}
+
+func NewBVH(objects []Hittable) *BVH {
+	prims := make([]bvhPrimitive, len(objects))
+	for i, obj := range objects {
+		box := obj.BoundingBox()
+		prims[i] = bvhPrimitive{Box: box, Centroid: box.Centroid(), Object: obj, Index: i}
+	}
+	bvh := &BVH{
+		nodes:   make([]bvhNode, 0, 2*len(prims)),
+		objects: make([]Hittable, len(prims)),
+		indices: make([]int, len(prims)),
+	}
+	if len(prims) > 0 {
+		bvh.build(prims, 0)
+	}
+	return bvh
+}
+
+func (b *BVH) build(prims []bvhPrimitive, offset int) int {
+	index := len(b.nodes)
+	b.nodes = append(b.nodes, bvhNode{})
+
+	box := math3.EmptyAABB
+	centroids := math3.EmptyAABB
+	for _, p := range prims {
+		box = box.Union(p.Box)
+		centroids = centroids.Extend(p.Centroid)
+	}
+
+	axis := centroids.LongestAxis()
+	extent := centroids.Axis(axis)
+
+	if len(prims) <= bvhMaxLeafSize || extent.Size() <= 0 {
+		b.makeLeaf(index, box, prims, offset)
+		return index
+	}
+
+	mid, ok := splitSAH(prims, box, extent, axis)
+	if !ok {
+		if len(prims) <= bvhMaxLeafSize*4 {
+			b.makeLeaf(index, box, prims, offset)
+			return index
+		}
+		// SAH found nothing better than a leaf but the leaf would be huge,
+		// fall back to a median split
+		slices.SortFunc(prims, func(a bvhPrimitive, b bvhPrimitive) int {
+			return cmp.Compare(a.Centroid[axis], b.Centroid[axis])
+		})
+		mid = len(prims) / 2
+	}
+
+	b.build(prims[:mid], offset)
+	right := b.build(prims[mid:], offset+mid)
+	b.nodes[index] = bvhNode{Box: box, Offset: right, Axis: axis}
+	return index
+}
+
+func (b *BVH) makeLeaf(index int, box math3.AABB, prims []bvhPrimitive, offset int) {
+	for i, p := range prims {
+		b.objects[offset+i] = p.Object
+		b.indices[offset+i] = p.Index
+	}
+	b.nodes[index] = bvhNode{Box: box, Offset: offset, Count: len(prims)}
+}
+
+// splitSAH partitions prims in place along axis using binned surface area
+// heuristic and returns the split position, or false when a leaf is cheaper.
+func splitSAH(prims []bvhPrimitive, box math3.AABB, extent math3.Interval, axis int) (int, bool) {
+	type bin struct {
+		box   math3.AABB
+		count int
+	}
+	var bins [bvhBins]bin
+	for i := range bins {
+		bins[i].box = math3.EmptyAABB
+	}
+	binOf := func(p bvhPrimitive) int {
+		n := int(bvhBins * (p.Centroid[axis] - extent.Min) / extent.Size())
+		return min(n, bvhBins-1)
+	}
+	for _, p := range prims {
+		n := binOf(p)
+		bins[n].count++
+		bins[n].box = bins[n].box.Union(p.Box)
+	}
+
+	// sweep from the right to collect the cost of every right hand side
+	var rightArea [bvhBins]float64
+	var rightCount [bvhBins]int
+	acc, count := math3.EmptyAABB, 0
+	for i := bvhBins - 1; i > 0; i-- {
+		acc = acc.Union(bins[i].box)
+		count += bins[i].count
+		rightArea[i] = acc.SurfaceArea()
+		rightCount[i] = count
+	}
+
+	bestCost, bestSplit := float64(len(prims)), -1
+	acc, count = math3.EmptyAABB, 0
+	parentArea := box.SurfaceArea()
+	for i := 0; i < bvhBins-1; i++ {
+		acc = acc.Union(bins[i].box)
+		count += bins[i].count
+		if count == 0 || rightCount[i+1] == 0 {
+			continue
+		}
+		cost := bvhTraversalCost + (float64(count)*acc.SurfaceArea()+float64(rightCount[i+1])*rightArea[i+1])/parentArea
+		if cost < bestCost {
+			bestCost, bestSplit = cost, i
+		}
+	}
+	if bestSplit < 0 {
+		return 0, false
+	}
+
+	mid := 0
+	for i := range prims {
+		if binOf(prims[i]) <= bestSplit {
+			prims[i], prims[mid] = prims[mid], prims[i]
+			mid++
+		}
+	}
+	return mid, true
+}
+
+func (b *BVH) Origin() math3.Vec3 {
+	return b.BoundingBox().Centroid()
+}
+
+func (b *BVH) Prepare() {}
+
+func (b *BVH) BoundingBox() math3.AABB {
+	if len(b.nodes) == 0 {
+		return math3.EmptyAABB
+	}
+	return b.nodes[0].Box
+}
+
+func (b *BVH) Hit(ray math3.Ray, rayT math3.Interval) (HitRecord, bool) {
+	rec := HitRecord{}
+	hitAnything := false
+	if len(b.nodes) == 0 {
+		return rec, false
+	}
+	closestSoFar := rayT.Max
+	invDir := ray.InvDirection()
+	stack := make([]int, 0, 64)
+	node := 0
+	for {
+		n := &b.nodes[node]
+		if n.Box.HitInv(ray.Origin, invDir, math3.Interval{Min: rayT.Min, Max: closestSoFar}) {
+			if n.Count > 0 {
+				for i, obj := range b.objects[n.Offset : n.Offset+n.Count] {
+					if localRec, hasHit := obj.Hit(ray, math3.Interval{Min: rayT.Min, Max: closestSoFar}); hasHit {
+						hitAnything = true
+						closestSoFar = localRec.T
+						rec = localRec
+						rec.Object = b.indices[n.Offset+i]
+					}
+				}
+			} else {
+				// visit the child closest to the ray origin first
+				if invDir[n.Axis] < 0 {
+					stack = append(stack, node+1)
+					node = n.Offset
+				} else {
+					stack = append(stack, n.Offset)
+					node = node + 1
+				}
+				continue
+			}
+		}
+		if len(stack) == 0 {
+			break
+		}
+		node = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+	}
+	return rec, hitAnything
+}
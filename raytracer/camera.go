@@ -1,13 +1,9 @@
 package raytracer
 
 import (
-	"fmt"
-	"image"
-	"image/color"
 	"math"
-	"math/rand/v2"
+	"raytracer/imageio"
 	"raytracer/math3"
-	"runtime"
 )
 
 type Camera struct {
@@ -79,114 +75,139 @@ func NewCamera(params CameraParams) *Camera {
 	return cam
 }
 
-func (cam *Camera) Render(world *World, usePool bool) *image.RGBA {
-	if !usePool {
-		img := image.NewRGBA(image.Rect(0, 0, cam.Width, cam.Height))
-		for y := 0; y < cam.Height; y++ {
-			fmt.Printf("Rendering scanline %d\n", y)
-			for x := 0; x < cam.Width; x++ {
-				img.Set(x, y, cam.RenderPixel(x, y, world))
-			}
-		}
-		return img
+func (cam *Camera) RenderPixel(x int, y int, world *World, integrator Integrator, seed uint64) math3.Vec3 {
+	pixelColor := math3.Vec3{}
+	s := &math3.Sampler{}
+	for sample := 0; sample < cam.SamplesPerPixel; sample++ {
+		seedSample(s, seed, x, y, sample)
+		r := cam.GetRay(x, y, s)
+		pixelColor = pixelColor.Add(integrator.Li(r, world, s))
 	}
-	return cam.RenderAsync(world)
+	return pixelColor.Scale(cam.PixelSampleScale)
 }
 
-func (cam *Camera) RenderAsync(world *World) *image.RGBA {
-	img := image.NewRGBA(image.Rect(0, 0, cam.Width, cam.Height))
-	numWorkers := runtime.NumCPU() - 1
-	chunkSize := 32
-	wp := NewWorkerPool(numWorkers, world)
-	totalChunks := int(math.Ceil(float64(cam.Width)/float64(chunkSize))) * int(math.Ceil(float64(cam.Height)/float64(chunkSize)))
-	chunks := make([]WorkerJob, 0, totalChunks)
-	chunkID := 0
-
-	for y := 0; y < cam.Height; y += chunkSize {
-		for x := 0; x < cam.Width; x += chunkSize {
-			chunks = append(chunks, WorkerJob{
-				XStart: x,
-				YStart: y,
-				XEnd:   min(x+chunkSize, cam.Width),
-				YEnd:   min(y+chunkSize, cam.Height),
-				Chunk:  chunkID,
-			})
-			chunkID++
-		}
-	}
-
-	rand.Shuffle(len(chunks), func(i, j int) {
-		chunks[i], chunks[j] = chunks[j], chunks[i]
-	})
-
-	wp.Start(chunkID, img, cam.RenderPixel)
-	fmt.Printf("Total jobs: %d\n", chunkID+1)
-	for _, job := range chunks {
-		wp.Jobs <- job
-	}
+// pixelSamples sums the samples taken for a pixel.
+type pixelSamples struct {
+	Color      math3.Vec3
+	LumSum     float64
+	LumSquares float64
+	Count      int
+}
 
-	wp.Wait()
-	return img
+func (ps *pixelSamples) add(other pixelSamples) {
+	ps.Color = ps.Color.Add(other.Color)
+	ps.LumSum += other.LumSum
+	ps.LumSquares += other.LumSquares
+	ps.Count += other.Count
 }
 
-func (cam *Camera) RenderPixel(x int, y int, world *World) color.Color {
-	pixelColor := math3.Vec3{}
-	for sample := 0; sample < cam.SamplesPerPixel; sample++ {
-		r := cam.GetRay(x, y)
-		pixelColor = pixelColor.Add(cam.RayColor(r, cam.MaxDepth, world))
+func (ps pixelSamples) mean() math3.Vec3 {
+	if ps.Count == 0 {
+		return math3.Vec3{}
 	}
-	return convertPixel(pixelColor.Scale(cam.PixelSampleScale))
+	return ps.Color.Div(float64(ps.Count))
 }
 
-func (cam *Camera) GetRay(x, y int) math3.Ray {
-	offsetX, offsetY := rand.Float64()-0.5, rand.Float64()-0.5
-	pixelSample := cam.Pixel00Loc.Add(cam.PixelDeltaU.Scale(float64(x) + offsetX)).Add(cam.PixelDeltaV.Scale(float64(y) + offsetY))
-	rayOrigin := cam.DefocusDiskSample()
-	if cam.DefocusAngle <= 0 {
-		rayOrigin = cam.Center
+// variance of the mean luminance
+func (ps pixelSamples) variance() float64 {
+	if ps.Count < 2 {
+		return 0
 	}
-	rayDirection := pixelSample.Sub(rayOrigin)
-	return math3.Ray{Origin: rayOrigin, Direction: rayDirection}
+	n := float64(ps.Count)
+	mean := ps.LumSum / n
+	return max(ps.LumSquares-n*mean*mean, 0) / (n - 1) / n
 }
 
-func (cam *Camera) DefocusDiskSample() math3.Vec3 {
-	p := math3.RandomInUnitDisk()
-	return cam.Center.Add(cam.DefocusDiskU.Scale(p.X())).Add(cam.DefocusDiskV.Scale(p.Y()))
+// seedSample points s at the random sequence of one sample of a pixel.
+func seedSample(s *math3.Sampler, seed uint64, x int, y int, sample int) {
+	s.Seed(seed, uint64(x), uint64(y), uint64(sample))
 }
 
-func (cam *Camera) RayColor(r math3.Ray, depth int, world *World) math3.Vec3 {
-	if depth <= 0 {
-		return math3.Vec3{0.0, 0.0, 0.0}
+// samplePixel is RenderPixel taking up to maxSamples samples, numbered from
+// first, that also writes the pixel of every AOV image and, with adaptive
+// sampling, stops once the pixel has converged. Surface AOVs are averaged
+// over the samples that hit something, IDs come from the first one.
+func (cam *Camera) samplePixel(x int, y int, world *World, opts RenderOptions, aovs map[AOV]*imageio.FloatImage, first int, maxSamples int) pixelSamples {
+	forward := cam.LookAt.Sub(cam.LookFrom).Normalize()
+	// only surface AOVs need the first intersection of each sample, it is
+	// handed to the integrator when it can start from it
+	surface := false
+	for aov := range aovs {
+		surface = surface || (aov != AOVVariance && aov != AOVSamples)
 	}
-	if result, hasHit := world.Hit(r, Interval{Min: 0.001, Max: math.MaxFloat64}); hasHit {
-		if attenuation, scattered, ok := result.Material.Scatter(r, result); ok {
-			survivalScale, shouldTerminate := cam.ShouldTerminateRay(&attenuation, depth)
-			if shouldTerminate {
-				return math3.Vec3{0.0, 0.0, 0.0}
-			}
-			if survivalScale > 0 {
-				attenuation = attenuation.Scale(1 / survivalScale)
+	hi, reuseHit := opts.Integrator.(hitIntegrator)
+
+	ps := pixelSamples{}
+	var sums [aovCount]math3.Vec3
+	hits := 0
+	s := &math3.Sampler{}
+	for ps.Count < maxSamples {
+		seedSample(s, opts.Seed, x, y, first+ps.Count)
+		r := cam.GetRay(x, y, s)
+		var rec HitRecord
+		var hasHit bool
+		var li math3.Vec3
+		switch {
+		case surface && reuseHit:
+			rec, hasHit = firstHit(r, world)
+			li = hi.liHit(r, rec, hasHit, world, s)
+		case surface:
+			li = opts.Integrator.Li(r, world, s)
+			rec, hasHit = firstHit(r, world)
+		default:
+			li = opts.Integrator.Li(r, world, s)
+		}
+		l := luminance(li)
+		ps.add(pixelSamples{Color: li, LumSum: l, LumSquares: l * l, Count: 1})
+		if surface {
+			if hasHit {
+				if hits == 0 {
+					materialID, objectID := float64(rec.MaterialID), float64(rec.Object+1)
+					sums[AOVMaterialID] = math3.Vec3{materialID, materialID, materialID}
+					sums[AOVObjectID] = math3.Vec3{objectID, objectID, objectID}
+				}
+				hits++
+				depth := math3.Dot(rec.P.Sub(cam.Center), forward)
+				sums[AOVAlbedo] = sums[AOVAlbedo].Add(surfaceAlbedo(r, rec, s))
+				sums[AOVNormal] = sums[AOVNormal].Add(rec.Normal)
+				sums[AOVDepth] = sums[AOVDepth].Add(math3.Vec3{depth, depth, depth})
+				sums[AOVPosition] = sums[AOVPosition].Add(rec.P)
 			}
-			return cam.RayColor(scattered, depth-1, world).Multiply(attenuation)
 		}
-		return math3.Vec3{}
+		if opts.Adaptive != nil && opts.Adaptive.converged(ps) {
+			break
+		}
 	}
-	d := r.Direction.Normalize()
-	a := 0.5 * (d.Y() + 1.0)
-	return math3.Vec3{1.0, 1.0, 1.0}.Scale(1.0 - a).Add(math3.Vec3{0.5, 0.7, 1.0}.Scale(a))
-}
 
-func (cam *Camera) ShouldTerminateRay(attenuation *math3.Vec3, depth int) (float64, bool) {
-	energy := attenuation.MaxComponent()
-	var survivalProb float64
-	// Start using Russian Roulette after a few bounces
-	if depth < cam.MaxDepth-2 {
-		terminationProb := math.Max(0.0, 1.0-energy)
-		if rand.Float64() < terminationProb {
-			return 0, true
+	variance, samples := ps.variance(), float64(ps.Count)
+	sums[AOVVariance] = math3.Vec3{variance, variance, variance}
+	sums[AOVSamples] = math3.Vec3{samples, samples, samples}
+	coverage := float32(float64(hits) / samples)
+	for aov, img := range aovs {
+		v := sums[aov]
+		switch aov {
+		case AOVAlbedo, AOVNormal, AOVDepth, AOVPosition:
+			if hits > 0 {
+				v = v.Div(float64(hits))
+			}
 		}
+		img.Set(x, y, [4]float32{float32(v[0]), float32(v[1]), float32(v[2]), coverage})
+	}
+	return ps
+}
 
-		survivalProb = 1.0 - terminationProb
+func (cam *Camera) GetRay(x int, y int, s *math3.Sampler) math3.Ray {
+	offsetX, offsetY := s.Float64()-0.5, s.Float64()-0.5
+	pixelSample := cam.Pixel00Loc.Add(cam.PixelDeltaU.Scale(float64(x) + offsetX)).Add(cam.PixelDeltaV.Scale(float64(y) + offsetY))
+	rayOrigin := cam.DefocusDiskSample(s)
+	if cam.DefocusAngle <= 0 {
+		rayOrigin = cam.Center
 	}
-	return survivalProb, false
+	rayDirection := pixelSample.Sub(rayOrigin)
+	return math3.Ray{Origin: rayOrigin, Direction: rayDirection}
+}
+
+func (cam *Camera) DefocusDiskSample(s *math3.Sampler) math3.Vec3 {
+	p := math3.RandomInUnitDisk(s)
+	return cam.Center.Add(cam.DefocusDiskU.Scale(p.X())).Add(cam.DefocusDiskV.Scale(p.Y()))
 }
@@ -0,0 +1,115 @@
+package raytracer
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const checkpointVersion = 2
+
+// Checkpoint is the state of a progressive render persisted so it can be
+// resumed after a crash or interruption: the accumulated samples of every
+// pixel, the completed passes and the state of the generator ordering the
+// tiles. Samples are seeded by their index, so a resumed pixel continues
+// with the sequence it would have drawn next.
+type Checkpoint struct {
+	Version int
+	// identifies the scene and camera the samples belong to, see
+	// scene.Scene.Hash
+	Scene  string
+	Width  int
+	Height int
+	Passes int
+	// samples per pixel reached by the completed passes, the last one may
+	// have stopped short of a power of two
+	SamplesPerPixel int
+	RNG             []byte
+	Pixels          []pixelSamples
+}
+
+// Checkpoint captures the current state of the render, it can be called
+// while Run is in progress.
+func (p *Progressive) Checkpoint() *Checkpoint {
+	c := &Checkpoint{Version: checkpointVersion, Width: p.accum.Width, Height: p.accum.Height}
+	p.mu.Lock()
+	c.Passes, c.SamplesPerPixel, c.RNG = p.passes, p.reached, p.rngState
+	p.mu.Unlock()
+	p.accum.mu.Lock()
+	c.Pixels = slices.Clone(p.accum.pixels)
+	p.accum.mu.Unlock()
+	return c
+}
+
+// Resume continues from a checkpoint, it must be called before Run.
+func (p *Progressive) Resume(c *Checkpoint) error {
+	if c.Width != p.accum.Width || c.Height != p.accum.Height {
+		return fmt.Errorf("checkpoint is %dx%d, the camera renders %dx%d", c.Width, c.Height, p.accum.Width, p.accum.Height)
+	}
+	if len(c.Pixels) != c.Width*c.Height {
+		return fmt.Errorf("checkpoint has %d pixels, expected %d", len(c.Pixels), c.Width*c.Height)
+	}
+	if err := p.rng.UnmarshalBinary(c.RNG); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	p.mu.Lock()
+	p.passes, p.reached, p.rngState = c.Passes, c.SamplesPerPixel, c.RNG
+	p.mu.Unlock()
+	p.accum.mu.Lock()
+	copy(p.accum.pixels, c.Pixels)
+	p.accum.mu.Unlock()
+	return nil
+}
+
+func (c *Checkpoint) Encode(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(c)
+}
+
+func DecodeCheckpoint(r io.Reader) (*Checkpoint, error) {
+	c := &Checkpoint{}
+	if err := gob.NewDecoder(r).Decode(c); err != nil {
+		return nil, err
+	}
+	if c.Version != checkpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %d, expected %d", c.Version, checkpointVersion)
+	}
+	return c, nil
+}
+
+// Save writes the checkpoint to a temporary file renamed over path, so a
+// crash while saving leaves the previous checkpoint intact.
+func (c *Checkpoint) Save(path string) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := c.Encode(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	c, err := DecodeCheckpoint(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
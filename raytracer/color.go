@@ -1,27 +1,87 @@
 package raytracer
 
 import (
+	"image"
 	"image/color"
 	"math"
+	"raytracer/imageio"
 	"raytracer/math3"
 )
 
-func colorToInt(val float64) uint8 {
-	return uint8(math.Floor(val))
-}
+// displayRange is the part of the encoded signal integer pixels represent,
+// tone mapping is responsible for bringing highlights into it.
+var displayRange = math3.Interval{Min: 0, Max: 1}
 
-func linearToGamma(val float64) float64 {
-	if val > 0 {
-		return math.Sqrt(val)
+// colorToInt encodes a linear value and quantizes it to [0, maxValue], the
+// threshold in [0, 1) is the dither offset added before truncating.
+func colorToInt(val float64, maxValue float64, threshold float64) float64 {
+	if math.IsNaN(val) {
+		return 0
 	}
-	return 0
+	return min(math.Floor(displayRange.Clamp(linearToSRGB(val))*maxValue+threshold), maxValue)
 }
 
-func convertPixel(pixel math3.Vec3) color.Color {
+func convertPixel(pixel [4]float32, threshold float64) color.RGBA {
 	return color.RGBA{
-		R: colorToInt(linearToGamma(pixel[0]) * 255),
-		G: colorToInt(linearToGamma(pixel[1]) * 255),
-		B: colorToInt(linearToGamma(pixel[2]) * 255),
-		A: 255,
+		R: uint8(colorToInt(float64(pixel[0]), math.MaxUint8, threshold)),
+		G: uint8(colorToInt(float64(pixel[1]), math.MaxUint8, threshold)),
+		B: uint8(colorToInt(float64(pixel[2]), math.MaxUint8, threshold)),
+		A: math.MaxUint8,
+	}
+}
+
+func convertPixel64(pixel [4]float32, threshold float64) color.RGBA64 {
+	return color.RGBA64{
+		R: uint16(colorToInt(float64(pixel[0]), math.MaxUint16, threshold)),
+		G: uint16(colorToInt(float64(pixel[1]), math.MaxUint16, threshold)),
+		B: uint16(colorToInt(float64(pixel[2]), math.MaxUint16, threshold)),
+		A: math.MaxUint16,
+	}
+}
+
+// ToRGBA encodes a tone mapped linear framebuffer as an 8-bit sRGB image.
+func ToRGBA(img *imageio.FloatImage, dither Dither) *image.RGBA {
+	out := image.NewRGBA(image.Rect(0, 0, img.Width, img.Height))
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			out.SetRGBA(x, y, convertPixel(img.At(x, y), dither.threshold(x, y)))
+		}
+	}
+	return out
+}
+
+// ToRGBA64 is ToRGBA with 16 bits per channel.
+func ToRGBA64(img *imageio.FloatImage, dither Dither) *image.RGBA64 {
+	out := image.NewRGBA64(image.Rect(0, 0, img.Width, img.Height))
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			out.SetRGBA64(x, y, convertPixel64(img.At(x, y), dither.threshold(x, y)))
+		}
+	}
+	return out
+}
+
+// ToImage quantizes to 8 or 16 bits per channel.
+func ToImage(img *imageio.FloatImage, bitDepth int, dither Dither) image.Image {
+	if bitDepth == 16 {
+		return ToRGBA64(img, dither)
+	}
+	return ToRGBA(img, dither)
+}
+
+// Heatmap visualizes a samples AOV, pixels go from dark blue for no samples
+// through cyan, green and yellow to red for maxSamples.
+func Heatmap(samples *imageio.FloatImage, maxSamples int) *image.RGBA {
+	stops := []math3.Vec3{{0, 0, 0.3}, {0, 0.8, 1}, {0, 0.9, 0}, {1, 1, 0}, {1, 0, 0}}
+	out := image.NewRGBA(image.Rect(0, 0, samples.Width, samples.Height))
+	for y := 0; y < samples.Height; y++ {
+		for x := 0; x < samples.Width; x++ {
+			t := displayRange.Clamp(float64(samples.At(x, y)[0]) / float64(max(maxSamples, 1)))
+			segment := min(int(t*float64(len(stops)-1)), len(stops)-2)
+			f := t*float64(len(stops)-1) - float64(segment)
+			c := stops[segment].Scale(1 - f).Add(stops[segment+1].Scale(f))
+			out.SetRGBA(x, y, color.RGBA{R: uint8(255 * c[0]), G: uint8(255 * c[1]), B: uint8(255 * c[2]), A: 255})
+		}
 	}
+	return out
 }
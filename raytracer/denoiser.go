@@ -3,12 +3,22 @@ package raytracer
 import (
 	"image"
 	"image/color"
+	"image/draw"
 	"math"
+	"raytracer/imageio"
+	"runtime"
+	"sync"
+	"sync/atomic"
 )
 
-func BilateralFilter(input image.Image, spatialSigma, rangeSigma float64) *image.RGBA {
+// BilateralFilter smooths input while preserving edges, 16-bit images stay
+// 16-bit.
+func BilateralFilter(input image.Image, spatialSigma, rangeSigma float64) draw.Image {
 	bounds := input.Bounds()
-	output := image.NewRGBA(bounds)
+	var output draw.Image = image.NewRGBA(bounds)
+	if _, deep := input.(*image.RGBA64); deep {
+		output = image.NewRGBA64(bounds)
+	}
 
 	// Calculate kernel radius based on spatialSigma
 	// Use 3 * sigma to capture most of the Gaussian curve
@@ -69,11 +79,11 @@ func BilateralFilter(input image.Image, spatialSigma, rangeSigma float64) *image
 			}
 
 			// Set output pixel
-			output.Set(x, y, color.RGBA{
-				R: uint8(math.Min(math.Max(0, sumR*255), 255)),
-				G: uint8(math.Min(math.Max(0, sumG*255), 255)),
-				B: uint8(math.Min(math.Max(0, sumB*255), 255)),
-				A: uint8(math.Min(math.Max(0, sumA*255), 255)),
+			output.Set(x, y, color.RGBA64{
+				R: uint16(math.Min(math.Max(0, sumR*65535), 65535)),
+				G: uint16(math.Min(math.Max(0, sumG*65535), 65535)),
+				B: uint16(math.Min(math.Max(0, sumB*65535), 65535)),
+				A: uint16(math.Min(math.Max(0, sumA*65535), 65535)),
 			})
 		}
 	}
@@ -93,3 +103,168 @@ func colorDistance(r1, g1, b1, a1, r2, g2, b2, a2 float64) float64 {
 	da := a1 - a2
 	return dr*dr + dg*dg + db*db + da*da
 }
+
+// JointBilateralParams configures JointBilateralFilter, a zero sigma leaves
+// that feature out of the weights.
+type JointBilateralParams struct {
+	SpatialSigma float64
+	// compared on Reinhard compressed color so highlights don't dominate
+	ColorSigma  float64
+	AlbedoSigma float64
+	NormalSigma float64
+	// relative to the depth of the center pixel
+	DepthSigma float64
+}
+
+// denoiseFeatures holds the AOVs guiding a filter, missing ones are nil.
+type denoiseFeatures struct {
+	albedo *imageio.FloatImage
+	normal *imageio.FloatImage
+	depth  *imageio.FloatImage
+}
+
+func newDenoiseFeatures(frame *Frame) denoiseFeatures {
+	return denoiseFeatures{
+		albedo: frame.AOVs[AOVAlbedo],
+		normal: frame.AOVs[AOVNormal],
+		depth:  frame.AOVs[AOVDepth],
+	}
+}
+
+// demodulate divides color by albedo so filters smooth the lighting but
+// not the texture, remodulate reverses it.
+func (f denoiseFeatures) demodulate(color *imageio.FloatImage) *imageio.FloatImage {
+	out := imageio.NewFloatImage(color.Width, color.Height)
+	copy(out.Pix, color.Pix)
+	if f.albedo == nil {
+		return out
+	}
+	for i := 0; i < len(out.Pix); i += 4 {
+		a := f.modulation(i)
+		for c := range 3 {
+			out.Pix[i+c] /= a[c]
+		}
+	}
+	return out
+}
+
+func (f denoiseFeatures) remodulate(img *imageio.FloatImage) {
+	if f.albedo == nil {
+		return
+	}
+	for i := 0; i < len(img.Pix); i += 4 {
+		a := f.modulation(i)
+		for c := range 3 {
+			img.Pix[i+c] *= a[c]
+		}
+	}
+}
+
+// modulation returns the albedo color is divided by at offset i of the
+// pixels. Pixels that missed every surface (the sky) or have a channel too
+// dark to divide by are left as they are, dividing them would blow their
+// color up and bleed it into the neighboring surfaces.
+func (f denoiseFeatures) modulation(i int) [3]float32 {
+	a := f.albedo.Pix[i : i+4]
+	if a[3] <= 0 || a[0] <= demodulateEpsilon || a[1] <= demodulateEpsilon || a[2] <= demodulateEpsilon {
+		return [3]float32{1, 1, 1}
+	}
+	return [3]float32{a[0], a[1], a[2]}
+}
+
+const demodulateEpsilon = 1e-3
+
+// JointBilateralFilter denoises the linear color of frame, neighbors are
+// weighted by distance and by how similar their color and the albedo, normal
+// and depth AOVs of the frame are to the center pixel's.
+func JointBilateralFilter(frame *Frame, params JointBilateralParams) *imageio.FloatImage {
+	features := newDenoiseFeatures(frame)
+	input := features.demodulate(frame.Color)
+	output := imageio.NewFloatImage(input.Width, input.Height)
+	radius := int(math.Ceil(3.0 * params.SpatialSigma))
+	weight := func(sigma float64, dist2 float64) float64 {
+		if sigma <= 0 {
+			return 0
+		}
+		return dist2 / (2 * sigma * sigma)
+	}
+
+	parallelRows(input.Height, func(y int) {
+		for x := 0; x < input.Width; x++ {
+			center := input.At(x, y)
+			var sum [4]float64
+			totalWeight := 0.0
+			for ny := max(y-radius, 0); ny <= min(y+radius, input.Height-1); ny++ {
+				for nx := max(x-radius, 0); nx <= min(x+radius, input.Width-1); nx++ {
+					neighbor := input.At(nx, ny)
+					exponent := weight(params.SpatialSigma, float64((nx-x)*(nx-x)+(ny-y)*(ny-y)))
+					exponent += weight(params.ColorSigma, compressedDistance(center, neighbor))
+					if features.albedo != nil {
+						exponent += weight(params.AlbedoSigma, pixelDistance(features.albedo, x, y, nx, ny))
+					}
+					if features.normal != nil {
+						exponent += weight(params.NormalSigma, pixelDistance(features.normal, x, y, nx, ny))
+					}
+					if features.depth != nil && params.DepthSigma > 0 {
+						d := features.depth.At(x, y)[0]
+						dd := float64(features.depth.At(nx, ny)[0]-d) / max(float64(d), 1e-6)
+						exponent += weight(params.DepthSigma, dd*dd)
+					}
+					w := math.Exp(-exponent)
+					for c := range 4 {
+						sum[c] += w * float64(neighbor[c])
+					}
+					totalWeight += w
+				}
+			}
+			output.Set(x, y, [4]float32{
+				float32(sum[0] / totalWeight),
+				float32(sum[1] / totalWeight),
+				float32(sum[2] / totalWeight),
+				float32(sum[3] / totalWeight),
+			})
+		}
+	})
+	features.remodulate(output)
+	return output
+}
+
+// compressedDistance is the squared RGB distance after mapping x to
+// x / (1 + x).
+func compressedDistance(a [4]float32, b [4]float32) float64 {
+	dist := 0.0
+	for c := range 3 {
+		ca, cb := float64(a[c]), float64(b[c])
+		d := ca/(1+max(ca, 0)) - cb/(1+max(cb, 0))
+		dist += d * d
+	}
+	return dist
+}
+
+// pixelDistance is the squared RGB distance between two pixels of img.
+func pixelDistance(img *imageio.FloatImage, x0 int, y0 int, x1 int, y1 int) float64 {
+	a, b := img.At(x0, y0), img.At(x1, y1)
+	dist := 0.0
+	for c := range 3 {
+		d := float64(a[c] - b[c])
+		dist += d * d
+	}
+	return dist
+}
+
+// parallelRows calls row for every y in [0, height) from one goroutine per
+// CPU.
+func parallelRows(height int, row func(y int)) {
+	next := atomic.Int64{}
+	wg := sync.WaitGroup{}
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := int(next.Add(1) - 1); y < height; y = int(next.Add(1) - 1) {
+				row(y)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,144 @@
+package raytracer
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+)
+
+// Dither selects the offset added to pixels before quantization, spreading
+// the rounding error to break up banding in smooth gradients.
+type Dither int
+
+const (
+	// DitherNone rounds to the nearest level
+	DitherNone Dither = iota
+	// DitherOrdered uses an 8x8 Bayer matrix
+	DitherOrdered
+	// DitherBlueNoise uses a tiled 64x64 void-and-cluster threshold map
+	DitherBlueNoise
+)
+
+func ParseDither(s string) (Dither, error) {
+	switch s {
+	case "", "none":
+		return DitherNone, nil
+	case "ordered":
+		return DitherOrdered, nil
+	case "bluenoise":
+		return DitherBlueNoise, nil
+	}
+	return DitherNone, fmt.Errorf("unknown dither %q", s)
+}
+
+func (d Dither) threshold(x int, y int) float64 {
+	switch d {
+	case DitherOrdered:
+		return (float64(bayer(x&7, y&7, 3)) + 0.5) / 64
+	case DitherBlueNoise:
+		return blueNoise()[(y%blueNoiseSize)*blueNoiseSize+x%blueNoiseSize]
+	default:
+		return 0.5
+	}
+}
+
+// bayer returns the rank of (x, y) in a 2^bits square Bayer matrix by
+// interleaving the bits of x^y and y in reverse order.
+func bayer(x int, y int, bits int) int {
+	v := 0
+	for bit := range bits {
+		v = v<<2 | ((x^y)>>bit&1)<<1 | y>>bit&1
+	}
+	return v
+}
+
+const (
+	blueNoiseSize  = 64
+	blueNoiseSigma = 1.5
+)
+
+var blueNoise = sync.OnceValue(func() []float64 {
+	return voidAndCluster(blueNoiseSize, blueNoiseSigma, 1)
+})
+
+// voidAndCluster builds a size x size threshold map with Ulichney's
+// void-and-cluster method: pixels are ranked by repeatedly removing the
+// tightest cluster of an initial pattern and then filling the largest void,
+// using a toroidal gaussian to measure density.
+func voidAndCluster(size int, sigma float64, seed uint64) []float64 {
+	n := size * size
+	kernel := make([]float64, n)
+	for dy := range size {
+		for dx := range size {
+			wx, wy := float64(min(dx, size-dx)), float64(min(dy, size-dy))
+			kernel[dy*size+dx] = math.Exp(-(wx*wx + wy*wy) / (2 * sigma * sigma))
+		}
+	}
+	energy := make([]float64, n)
+	pattern := make([]bool, n)
+	toggle := func(p int, on bool) {
+		pattern[p] = on
+		sign := 1.0
+		if !on {
+			sign = -1
+		}
+		px, py := p%size, p/size
+		for y := range size {
+			row := ((y - py + size) % size) * size
+			for x := range size {
+				energy[y*size+x] += sign * kernel[row+(x-px+size)%size]
+			}
+		}
+	}
+	extreme := func(value bool, cmp func(a float64, b float64) bool) int {
+		best := -1
+		for p := range n {
+			if pattern[p] == value && (best < 0 || cmp(energy[p], energy[best])) {
+				best = p
+			}
+		}
+		return best
+	}
+	tightestCluster := func() int { return extreme(true, func(a, b float64) bool { return a > b }) }
+	largestVoid := func() int { return extreme(false, func(a, b float64) bool { return a < b }) }
+
+	// random initial pattern, relaxed until moving the tightest cluster into
+	// the largest void no longer changes anything
+	rng := rand.New(rand.NewPCG(seed, seed))
+	ones := n / 10
+	for _, p := range rng.Perm(n)[:ones] {
+		toggle(p, true)
+	}
+	for {
+		cluster := tightestCluster()
+		toggle(cluster, false)
+		void := largestVoid()
+		toggle(void, true)
+		if void == cluster {
+			break
+		}
+	}
+	initial := append([]bool(nil), pattern...)
+	initialEnergy := append([]float64(nil), energy...)
+
+	rank := make([]int, n)
+	for r := ones - 1; r >= 0; r-- {
+		p := tightestCluster()
+		toggle(p, false)
+		rank[p] = r
+	}
+	copy(pattern, initial)
+	copy(energy, initialEnergy)
+	for r := ones; r < n; r++ {
+		p := largestVoid()
+		toggle(p, true)
+		rank[p] = r
+	}
+
+	thresholds := make([]float64, n)
+	for p, r := range rank {
+		thresholds[p] = (float64(r) + 0.5) / float64(n)
+	}
+	return thresholds
+}
@@ -4,8 +4,9 @@ import "raytracer/math3"
 
 type Hittable interface {
 	Origin() math3.Vec3
-	Hit(ray math3.Ray, rayT Interval) (HitRecord, bool)
+	Hit(ray math3.Ray, rayT math3.Interval) (HitRecord, bool)
 	Prepare()
+	BoundingBox() math3.AABB
 }
 
 type HitRecord struct {
@@ -14,6 +15,16 @@ type HitRecord struct {
 	Normal    math3.Vec3
 	T         float64
 	Material  Material
+	// see AOVMaterialID
+	MaterialID int
+	// surface coordinates, barycentric for triangles without texture coordinates
+	U float64
+	V float64
+	// weights of the three triangle vertices at P
+	Barycentric math3.Vec3
+	// index of the hit object in the list the enclosing World or BVH was
+	// built from
+	Object int
 }
 
 func (hr *HitRecord) SetFaceNormal(r math3.Ray, outwardNormal math3.Vec3) {
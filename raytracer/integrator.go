@@ -0,0 +1,219 @@
+package raytracer
+
+import (
+	"fmt"
+	"math"
+	"raytracer/math3"
+)
+
+// Integrator computes the radiance arriving along a camera ray, drawing
+// random numbers from the sample's sampler.
+type Integrator interface {
+	Li(ray math3.Ray, world *World, s *math3.Sampler) math3.Vec3
+}
+
+// hitIntegrator is implemented by integrators that can start from the first
+// intersection of the ray, when the caller needs it anyway (e.g. for AOVs)
+// and would otherwise trace the camera ray twice.
+type hitIntegrator interface {
+	liHit(ray math3.Ray, rec HitRecord, hasHit bool, world *World, s *math3.Sampler) math3.Vec3
+}
+
+// firstHit intersects a camera ray with the world.
+func firstHit(ray math3.Ray, world *World) (HitRecord, bool) {
+	return world.Hit(ray, math3.Interval{Min: 0.001, Max: math.MaxFloat64})
+}
+
+func NewIntegrator(name string, maxDepth int) (Integrator, error) {
+	switch name {
+	case "", "path":
+		return PathTracer{MaxDepth: maxDepth}, nil
+	case "direct":
+		return DirectLighting{MaxDepth: maxDepth}, nil
+	case "ao":
+		return AmbientOcclusion{}, nil
+	case "normals":
+		return NormalsIntegrator{}, nil
+	}
+	return nil, fmt.Errorf("unknown integrator %q", name)
+}
+
+// PathTracer follows paths of up to MaxDepth bounces. Diffuse bounces sample
+// the registered lights directly and combine that estimate with the one
+// from BSDF sampling using multiple importance sampling.
+type PathTracer struct {
+	MaxDepth int
+}
+
+func (pt PathTracer) Li(ray math3.Ray, world *World, s *math3.Sampler) math3.Vec3 {
+	rec, hasHit := firstHit(ray, world)
+	return pt.liHit(ray, rec, hasHit, world, s)
+}
+
+func (pt PathTracer) liHit(ray math3.Ray, rec HitRecord, hasHit bool, world *World, s *math3.Sampler) math3.Vec3 {
+	return tracePath(ray, rec, hasHit, world, s, pt.MaxDepth, false)
+}
+
+// DirectLighting only accounts for light reaching the first diffuse surface
+// directly, specular chains before it are still followed.
+type DirectLighting struct {
+	MaxDepth int
+}
+
+func (dl DirectLighting) Li(ray math3.Ray, world *World, s *math3.Sampler) math3.Vec3 {
+	rec, hasHit := firstHit(ray, world)
+	return dl.liHit(ray, rec, hasHit, world, s)
+}
+
+func (dl DirectLighting) liHit(ray math3.Ray, rec HitRecord, hasHit bool, world *World, s *math3.Sampler) math3.Vec3 {
+	return tracePath(ray, rec, hasHit, world, s, dl.MaxDepth, true)
+}
+
+// tracePath follows the path starting with r, whose first intersection is
+// rec.
+func tracePath(r math3.Ray, rec HitRecord, hasHit bool, world *World, s *math3.Sampler, maxDepth int, directOnly bool) math3.Vec3 {
+	radiance := math3.Vec3{}
+	throughput := math3.Vec3{1, 1, 1}
+	// camera rays and specular bounces can't be light sampled, so emitters
+	// they hit count fully
+	specular := true
+	bsdfPdf := 0.0
+	for depth := maxDepth; depth > 0; depth-- {
+		if depth < maxDepth {
+			rec, hasHit = world.Hit(r, math3.Interval{Min: 0.001, Max: math.MaxFloat64})
+		}
+		if !hasHit {
+			radiance = radiance.Add(throughput.Multiply(world.BackgroundColor(r)))
+			break
+		}
+		if emitter, ok := rec.Material.(Emitter); ok {
+			emitted := emitter.Emitted(rec.U, rec.V, rec.P)
+			weight := 1.0
+			if !specular {
+				lightPdf := LightPDF{Lights: world.Lights, Origin: r.Origin}.Value(r.Direction)
+				weight = powerHeuristic(bsdfPdf, lightPdf)
+			}
+			radiance = radiance.Add(throughput.Multiply(emitted).Scale(weight))
+		}
+		if directOnly && !specular {
+			break
+		}
+
+		srec, ok := rec.Material.Scatter(r, rec, s)
+		if !ok {
+			break
+		}
+		var attenuation math3.Vec3
+		if srec.PDF == nil {
+			attenuation = srec.Attenuation
+			r = srec.SpecularRay
+			specular = true
+		} else {
+			if len(world.Lights) > 0 {
+				radiance = radiance.Add(throughput.Multiply(sampleLights(r, rec, srec, world, s)))
+			}
+			scattered := math3.Ray{Origin: rec.P, Direction: srec.PDF.Generate(s)}
+			bsdfPdf = srec.PDF.Value(scattered.Direction)
+			if bsdfPdf <= 0 {
+				break
+			}
+			attenuation = srec.Attenuation.Scale(rec.Material.ScatteringPDF(r, rec, scattered) / bsdfPdf)
+			r = scattered
+			specular = false
+		}
+
+		survivalScale, shouldTerminate := shouldTerminateRay(&attenuation, depth, maxDepth, s)
+		if shouldTerminate {
+			break
+		}
+		if survivalScale > 0 {
+			attenuation = attenuation.Scale(1 / survivalScale)
+		}
+		throughput = throughput.Multiply(attenuation)
+	}
+	return radiance
+}
+
+// sampleLights is the light sampling half of the MIS estimator: a direction
+// towards one of the lights, weighted against the BSDF sampling density.
+func sampleLights(r math3.Ray, rec HitRecord, srec ScatterRecord, world *World, s *math3.Sampler) math3.Vec3 {
+	lights := LightPDF{Lights: world.Lights, Origin: rec.P}
+	shadow := math3.Ray{Origin: rec.P, Direction: lights.Generate(s)}
+	lightPdf := lights.Value(shadow.Direction)
+	if lightPdf <= 0 {
+		return math3.Vec3{}
+	}
+	scatteringPdf := rec.Material.ScatteringPDF(r, rec, shadow)
+	if scatteringPdf <= 0 {
+		return math3.Vec3{}
+	}
+	lightRec, hasHit := world.Hit(shadow, math3.Interval{Min: 0.001, Max: math.MaxFloat64})
+	if !hasHit {
+		return math3.Vec3{}
+	}
+	emitter, ok := lightRec.Material.(Emitter)
+	if !ok {
+		return math3.Vec3{}
+	}
+	emitted := emitter.Emitted(lightRec.U, lightRec.V, lightRec.P)
+	weight := powerHeuristic(lightPdf, srec.PDF.Value(shadow.Direction))
+	return srec.Attenuation.Multiply(emitted).Scale(scatteringPdf * weight / lightPdf)
+}
+
+func shouldTerminateRay(attenuation *math3.Vec3, depth int, maxDepth int, s *math3.Sampler) (float64, bool) {
+	energy := attenuation.MaxComponent()
+	var survivalProb float64
+	// Start using Russian Roulette after a few bounces
+	if depth < maxDepth-2 {
+		terminationProb := math.Max(0.0, 1.0-energy)
+		if s.Float64() < terminationProb {
+			return 0, true
+		}
+
+		survivalProb = 1.0 - terminationProb
+	}
+	return survivalProb, false
+}
+
+// AmbientOcclusion shades the first hit by the fraction of cosine weighted
+// directions not blocked within Distance (0 for unlimited), rays missing
+// everything are white.
+type AmbientOcclusion struct {
+	Distance float64
+}
+
+func (ao AmbientOcclusion) Li(ray math3.Ray, world *World, s *math3.Sampler) math3.Vec3 {
+	rec, hasHit := firstHit(ray, world)
+	return ao.liHit(ray, rec, hasHit, world, s)
+}
+
+func (ao AmbientOcclusion) liHit(ray math3.Ray, rec HitRecord, hasHit bool, world *World, s *math3.Sampler) math3.Vec3 {
+	if !hasHit {
+		return math3.Vec3{1, 1, 1}
+	}
+	probe := math3.Ray{Origin: rec.P, Direction: NewCosinePDF(rec.Normal).Generate(s)}
+	maxT := math.MaxFloat64
+	if ao.Distance > 0 {
+		maxT = ao.Distance / probe.Direction.Length()
+	}
+	if _, occluded := world.Hit(probe, math3.Interval{Min: 0.001, Max: maxT}); occluded {
+		return math3.Vec3{}
+	}
+	return math3.Vec3{1, 1, 1}
+}
+
+// NormalsIntegrator maps the shading normal of the first hit to a color,
+// for debugging geometry.
+type NormalsIntegrator struct{}
+
+func (n NormalsIntegrator) Li(ray math3.Ray, world *World, s *math3.Sampler) math3.Vec3 {
+	rec, hasHit := firstHit(ray, world)
+	return n.liHit(ray, rec, hasHit, world, s)
+}
+
+func (NormalsIntegrator) liHit(ray math3.Ray, rec HitRecord, hasHit bool, world *World, s *math3.Sampler) math3.Vec3 {
+	if !hasHit {
+		return math3.Vec3{}
+	}
+	return rec.Normal.Add(math3.Vec3{1, 1, 1}).Scale(0.5)
+}
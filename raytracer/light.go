@@ -0,0 +1,60 @@
+package raytracer
+
+import (
+	"math"
+	"raytracer/math3"
+)
+
+// Light is a hittable that can be sampled directly, used for next event
+// estimation. PDFValue is the solid angle density of Random's directions.
+type Light interface {
+	Hittable
+	PDFValue(origin math3.Vec3, direction math3.Vec3) float64
+	Random(origin math3.Vec3, s *math3.Sampler) math3.Vec3
+}
+
+func (s *Sphere) PDFValue(origin math3.Vec3, direction math3.Vec3) float64 {
+	if _, ok := s.Hit(math3.Ray{Origin: origin, Direction: direction}, math3.Interval{Min: 0.001, Max: math.MaxFloat64}); !ok {
+		return 0
+	}
+	distSq := s.Center.Sub(origin).LengthSquared()
+	if distSq <= s.RadiusSquare {
+		// every direction from inside hits the sphere
+		return 1 / (4 * math.Pi)
+	}
+	cosThetaMax := math.Sqrt(1 - s.RadiusSquare/distSq)
+	solidAngle := 2 * math.Pi * (1 - cosThetaMax)
+	return 1 / solidAngle
+}
+
+func (s *Sphere) Random(origin math3.Vec3, sampler *math3.Sampler) math3.Vec3 {
+	direction := s.Center.Sub(origin)
+	distSq := direction.LengthSquared()
+	if distSq <= s.RadiusSquare {
+		return math3.RandomUnitVector(sampler)
+	}
+	return math3.NewONB(direction).Transform(math3.RandomToSphere(sampler, s.Radius, distSq))
+}
+
+func (t *Triangle) PDFValue(origin math3.Vec3, direction math3.Vec3) float64 {
+	rec, ok := t.Hit(math3.Ray{Origin: origin, Direction: direction}, math3.Interval{Min: 0.001, Max: math.MaxFloat64})
+	if !ok {
+		return 0
+	}
+	distSq := rec.T * rec.T * direction.LengthSquared()
+	cosine := math.Abs(math3.Dot(direction, rec.Normal)) / direction.Length()
+	area := 0.5 * math3.Cross(t.edge1, t.edge2).Length()
+	if cosine < math3.EPSILON || area <= 0 {
+		return 0
+	}
+	return distSq / (cosine * area)
+}
+
+func (t *Triangle) Random(origin math3.Vec3, s *math3.Sampler) math3.Vec3 {
+	u, v := s.Float64(), s.Float64()
+	if u+v > 1 {
+		u, v = 1-u, 1-v
+	}
+	p := t.V0.Add(t.edge1.Scale(u)).Add(t.edge2.Scale(v))
+	return p.Sub(origin)
+}
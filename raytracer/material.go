@@ -2,44 +2,67 @@ package raytracer
 
 import (
 	"math"
-	"math/rand/v2"
 	"raytracer/math3"
 )
 
 type Material interface {
-	Scatter(ray math3.Ray, rec HitRecord) (math3.Vec3, math3.Ray, bool)
+	Scatter(ray math3.Ray, rec HitRecord, s *math3.Sampler) (ScatterRecord, bool)
+	// ScatteringPDF is the cosine weighted BSDF divided by the albedo for
+	// scattering into the direction of scattered, 0 for specular materials.
+	ScatteringPDF(ray math3.Ray, rec HitRecord, scattered math3.Ray) float64
+}
+
+// ScatterRecord describes how a ray continues after hitting a surface,
+// specular materials have no PDF and continue along SpecularRay.
+type ScatterRecord struct {
+	Attenuation math3.Vec3
+	PDF         PDF
+	SpecularRay math3.Ray
+}
+
+// Emitter is implemented by materials that give off light.
+type Emitter interface {
+	Emitted(u float64, v float64, p math3.Vec3) math3.Vec3
 }
 
 type Lambertian struct {
-	Albedo math3.Vec3
+	Albedo Texture
 }
 
-func (l Lambertian) Scatter(ray math3.Ray, rec HitRecord) (math3.Vec3, math3.Ray, bool) {
-	scatterDir := rec.Normal.Add(math3.RandomUnitVector())
-	if scatterDir.IsNearZero() {
-		scatterDir = rec.Normal
-	}
-	return l.Albedo, math3.Ray{Origin: rec.P, Direction: scatterDir}, true
+func (l Lambertian) Scatter(ray math3.Ray, rec HitRecord, s *math3.Sampler) (ScatterRecord, bool) {
+	return ScatterRecord{
+		Attenuation: l.Albedo.Value(rec.U, rec.V, rec.P),
+		PDF:         NewCosinePDF(rec.Normal),
+	}, true
+}
+
+func (l Lambertian) ScatteringPDF(ray math3.Ray, rec HitRecord, scattered math3.Ray) float64 {
+	cosine := math3.Dot(rec.Normal, scattered.Direction.Normalize())
+	return math.Max(0, cosine/math.Pi)
 }
 
 type Metal struct {
 	Fuzz   float64
-	Albedo math3.Vec3
+	Albedo Texture
 }
 
-func (m Metal) Scatter(ray math3.Ray, rec HitRecord) (math3.Vec3, math3.Ray, bool) {
+func (m Metal) Scatter(ray math3.Ray, rec HitRecord, s *math3.Sampler) (ScatterRecord, bool) {
 	reflected := math3.Reflect(ray.Direction, rec.Normal)
-	reflected = reflected.Normalize().Add(math3.RandomUnitVector().Scale(m.Fuzz))
+	reflected = reflected.Normalize().Add(math3.RandomUnitVector(s).Scale(m.Fuzz))
 	scattered := math3.Ray{Origin: rec.P, Direction: reflected}
 	canScatter := math3.Dot(scattered.Direction, rec.Normal) > 0
-	return m.Albedo, scattered, canScatter
+	return ScatterRecord{Attenuation: m.Albedo.Value(rec.U, rec.V, rec.P), SpecularRay: scattered}, canScatter
+}
+
+func (m Metal) ScatteringPDF(ray math3.Ray, rec HitRecord, scattered math3.Ray) float64 {
+	return 0
 }
 
 type Dialectric struct {
 	RefractionIndex float64
 }
 
-func (d Dialectric) Scatter(ray math3.Ray, rec HitRecord) (math3.Vec3, math3.Ray, bool) {
+func (d Dialectric) Scatter(ray math3.Ray, rec HitRecord, s *math3.Sampler) (ScatterRecord, bool) {
 	ri := d.RefractionIndex
 	if rec.FrontFace {
 		ri = 1 / d.RefractionIndex
@@ -49,13 +72,17 @@ func (d Dialectric) Scatter(ray math3.Ray, rec HitRecord) (math3.Vec3, math3.Ray
 	sinT := math.Sqrt(math.Max(0.0, 1.0-cosT*cosT))
 	cannotRefract := ri*sinT > 1
 	var direction math3.Vec3
-	if cannotRefract || d.reflectance(cosT, ri) > rand.Float64() {
+	if cannotRefract || d.reflectance(cosT, ri) > s.Float64() {
 		direction = math3.Reflect(unitDir, rec.Normal)
 	} else {
 		direction = math3.Refract(unitDir, rec.Normal, ri)
 	}
 	scattered := math3.Ray{Origin: rec.P, Direction: direction}
-	return math3.Vec3{1, 1, 1}, scattered, true
+	return ScatterRecord{Attenuation: math3.Vec3{1, 1, 1}, SpecularRay: scattered}, true
+}
+
+func (d Dialectric) ScatteringPDF(ray math3.Ray, rec HitRecord, scattered math3.Ray) float64 {
+	return 0
 }
 
 func (d Dialectric) reflectance(cosine float64, refractionIndex float64) float64 {
@@ -63,3 +90,19 @@ func (d Dialectric) reflectance(cosine float64, refractionIndex float64) float64
 	r0 = r0 * r0
 	return r0 + (1-r0)*math.Pow(1-cosine, 5)
 }
+
+type DiffuseLight struct {
+	Emit Texture
+}
+
+func (d DiffuseLight) Scatter(ray math3.Ray, rec HitRecord, s *math3.Sampler) (ScatterRecord, bool) {
+	return ScatterRecord{}, false
+}
+
+func (d DiffuseLight) ScatteringPDF(ray math3.Ray, rec HitRecord, scattered math3.Ray) float64 {
+	return 0
+}
+
+func (d DiffuseLight) Emitted(u float64, v float64, p math3.Vec3) math3.Vec3 {
+	return d.Emit.Value(u, v, p)
+}
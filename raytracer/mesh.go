@@ -0,0 +1,129 @@
+package raytracer
+
+import (
+	"raytracer/math3"
+)
+
+// MeshFace indexes into the buffers of its Mesh, Normals and UVs hold -1
+// when the face has no such attribute.
+type MeshFace struct {
+	Vertices [3]int
+	Normals  [3]int
+	UVs      [3]int
+}
+
+// Mesh is an indexed triangle mesh, the buffers can be shared between
+// meshes (e.g. one per material of a model).
+type Mesh struct {
+	Positions []math3.Vec3
+	Normals   []math3.Vec3
+	UVs       [][2]float64
+	Faces     []MeshFace
+	Material  Material
+	// identifies Material in the material ID AOV, zero means unknown
+	MaterialID int
+	bvh        *BVH
+}
+
+type meshTriangle struct {
+	mesh  *Mesh
+	face  int
+	edge1 math3.Vec3
+	edge2 math3.Vec3
+}
+
+func NewMeshFace(v0, v1, v2 int) MeshFace {
+	return MeshFace{
+		Vertices: [3]int{v0, v1, v2},
+		Normals:  [3]int{-1, -1, -1},
+		UVs:      [3]int{-1, -1, -1},
+	}
+}
+
+func (m *Mesh) Prepare() {
+	triangles := make([]Hittable, len(m.Faces))
+	for i, face := range m.Faces {
+		v0 := m.Positions[face.Vertices[0]]
+		triangles[i] = &meshTriangle{
+			mesh:  m,
+			face:  i,
+			edge1: m.Positions[face.Vertices[1]].Sub(v0),
+			edge2: m.Positions[face.Vertices[2]].Sub(v0),
+		}
+	}
+	m.bvh = NewBVH(triangles)
+}
+
+func (m *Mesh) Origin() math3.Vec3 {
+	return m.BoundingBox().Centroid()
+}
+
+func (m *Mesh) BoundingBox() math3.AABB {
+	if m.bvh != nil {
+		return m.bvh.BoundingBox()
+	}
+	box := math3.EmptyAABB
+	for _, face := range m.Faces {
+		for _, v := range face.Vertices {
+			box = box.Extend(m.Positions[v])
+		}
+	}
+	return box.Pad(1e-4)
+}
+
+func (m *Mesh) Hit(ray math3.Ray, rayT math3.Interval) (HitRecord, bool) {
+	if m.bvh == nil {
+		return HitRecord{}, false
+	}
+	return m.bvh.Hit(ray, rayT)
+}
+
+func (t *meshTriangle) vertex(n int) math3.Vec3 {
+	return t.mesh.Positions[t.mesh.Faces[t.face].Vertices[n]]
+}
+
+func (t *meshTriangle) Prepare() {}
+
+func (t *meshTriangle) Origin() math3.Vec3 {
+	return t.vertex(0).Add(t.vertex(1)).Add(t.vertex(2)).Div(3)
+}
+
+func (t *meshTriangle) BoundingBox() math3.AABB {
+	return math3.NewAABB(t.vertex(0), t.vertex(1)).Extend(t.vertex(2)).Pad(1e-4)
+}
+
+func (t *meshTriangle) Hit(ray math3.Ray, rayT math3.Interval) (HitRecord, bool) {
+	root, u, v, ok := intersectTriangle(ray, t.vertex(0), t.edge1, t.edge2, rayT)
+	if !ok {
+		return HitRecord{}, false
+	}
+	face := t.mesh.Faces[t.face]
+	w := 1 - u - v
+
+	rec := HitRecord{}
+	rec.T = root
+	rec.P = ray.At(root)
+	rec.Barycentric = math3.Vec3{w, u, v}
+	rec.SetFaceNormal(ray, math3.Cross(t.edge1, t.edge2).Normalize())
+	if face.Normals[0] >= 0 {
+		normals := t.mesh.Normals
+		shading := normals[face.Normals[0]].Scale(w).
+			Add(normals[face.Normals[1]].Scale(u)).
+			Add(normals[face.Normals[2]].Scale(v)).
+			Normalize()
+		// keep the shading normal on the side of the surface the ray hit
+		if math3.Dot(shading, rec.Normal) < 0 {
+			shading = shading.Scale(-1)
+		}
+		rec.Normal = shading
+	}
+	rec.U, rec.V = u, v
+	if face.UVs[0] >= 0 {
+		uvs := t.mesh.UVs
+		uv0, uv1, uv2 := uvs[face.UVs[0]], uvs[face.UVs[1]], uvs[face.UVs[2]]
+		rec.U = w*uv0[0] + u*uv1[0] + v*uv2[0]
+		rec.V = w*uv0[1] + u*uv1[1] + v*uv2[1]
+	}
+	rec.Material, rec.MaterialID = t.mesh.Material, t.mesh.MaterialID
+	return rec, true
+}
@@ -0,0 +1,79 @@
+package raytracer
+
+import (
+	"math"
+	"raytracer/imageio"
+)
+
+// NLMeansParams configures NLMeansFilter.
+type NLMeansParams struct {
+	// neighbors within this many pixels are averaged
+	SearchRadius int
+	// half size of the patches compared to weigh them
+	PatchRadius int
+	// filtering strength h, patch distances well below h² average fully
+	Strength float64
+}
+
+var DefaultNLMeansParams = NLMeansParams{SearchRadius: 7, PatchRadius: 2, Strength: 0.05}
+
+// NLMeansFilter is a non-local means denoiser: every pixel becomes the
+// average of the pixels in its search window, weighted by how similar the
+// patches around them are. Patches are compared on Reinhard compressed color
+// so bright highlights don't dominate the distances.
+func NLMeansFilter(img *imageio.FloatImage, params NLMeansParams) *imageio.FloatImage {
+	width, height := img.Width, img.Height
+	compressed := make([]float32, len(img.Pix))
+	for i, v := range img.Pix {
+		compressed[i] = v / (1 + max(v, 0))
+	}
+	output := imageio.NewFloatImage(width, height)
+	h2 := params.Strength * params.Strength
+	r := params.PatchRadius
+
+	parallelRows(height, func(y int) {
+		for x := range width {
+			var sum [4]float64
+			totalWeight := 0.0
+			for qy := max(y-params.SearchRadius, 0); qy <= min(y+params.SearchRadius, height-1); qy++ {
+				for qx := max(x-params.SearchRadius, 0); qx <= min(x+params.SearchRadius, width-1); qx++ {
+					dist, count := 0.0, 0
+					for dy := -r; dy <= r; dy++ {
+						py, ny := y+dy, qy+dy
+						if py < 0 || py >= height || ny < 0 || ny >= height {
+							continue
+						}
+						for dx := -r; dx <= r; dx++ {
+							px, nx := x+dx, qx+dx
+							if px < 0 || px >= width || nx < 0 || nx >= width {
+								continue
+							}
+							a, b := 4*(py*width+px), 4*(ny*width+nx)
+							for c := range 3 {
+								d := float64(compressed[a+c] - compressed[b+c])
+								dist += d * d
+							}
+							count++
+						}
+					}
+					w := 1.0
+					if count > 0 && h2 > 0 {
+						w = math.Exp(-dist / float64(3*count) / h2)
+					}
+					q := img.At(qx, qy)
+					for c := range 4 {
+						sum[c] += w * float64(q[c])
+					}
+					totalWeight += w
+				}
+			}
+			output.Set(x, y, [4]float32{
+				float32(sum[0] / totalWeight),
+				float32(sum[1] / totalWeight),
+				float32(sum[2] / totalWeight),
+				float32(sum[3] / totalWeight),
+			})
+		}
+	})
+	return output
+}
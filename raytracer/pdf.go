@@ -0,0 +1,62 @@
+package raytracer
+
+import (
+	"math"
+	"raytracer/math3"
+)
+
+// PDF is a distribution of directions, Value is the solid angle density of
+// the directions Generate returns.
+type PDF interface {
+	Value(direction math3.Vec3) float64
+	Generate(s *math3.Sampler) math3.Vec3
+}
+
+type CosinePDF struct {
+	uvw math3.ONB
+}
+
+func NewCosinePDF(normal math3.Vec3) CosinePDF {
+	return CosinePDF{uvw: math3.NewONB(normal)}
+}
+
+func (c CosinePDF) Value(direction math3.Vec3) float64 {
+	cosine := math3.Dot(direction.Normalize(), c.uvw.W)
+	return math.Max(0, cosine/math.Pi)
+}
+
+func (c CosinePDF) Generate(s *math3.Sampler) math3.Vec3 {
+	return c.uvw.Transform(math3.RandomCosineDirection(s))
+}
+
+// LightPDF picks one of the lights uniformly and samples a direction
+// towards it from Origin.
+type LightPDF struct {
+	Lights []Light
+	Origin math3.Vec3
+}
+
+func (l LightPDF) Value(direction math3.Vec3) float64 {
+	if len(l.Lights) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, light := range l.Lights {
+		sum += light.PDFValue(l.Origin, direction)
+	}
+	return sum / float64(len(l.Lights))
+}
+
+func (l LightPDF) Generate(s *math3.Sampler) math3.Vec3 {
+	return l.Lights[s.IntN(len(l.Lights))].Random(l.Origin, s)
+}
+
+// powerHeuristic is the multiple importance sampling weight of a sample
+// drawn from the strategy with density pdfA.
+func powerHeuristic(pdfA float64, pdfB float64) float64 {
+	a, b := pdfA*pdfA, pdfB*pdfB
+	if a+b == 0 {
+		return 0
+	}
+	return a / (a + b)
+}
@@ -0,0 +1,81 @@
+package raytracer
+
+import (
+	"math"
+	"math/rand/v2"
+	"raytracer/math3"
+)
+
+const perlinPointCount = 256
+
+type Perlin struct {
+	gradients [perlinPointCount]math3.Vec3
+	permX     [perlinPointCount]int
+	permY     [perlinPointCount]int
+	permZ     [perlinPointCount]int
+}
+
+func NewPerlin(seed uint64) *Perlin {
+	rng := rand.New(rand.NewPCG(seed, 0x9e3779b97f4a7c15))
+	p := &Perlin{}
+	for i := range p.gradients {
+		for {
+			g := math3.Vec3{2*rng.Float64() - 1, 2*rng.Float64() - 1, 2*rng.Float64() - 1}
+			if l := g.LengthSquared(); l > 1e-6 && l <= 1 {
+				p.gradients[i] = g.Normalize()
+				break
+			}
+		}
+	}
+	for _, perm := range []*[perlinPointCount]int{&p.permX, &p.permY, &p.permZ} {
+		for i := range perm {
+			perm[i] = i
+		}
+		rng.Shuffle(perlinPointCount, func(i, j int) {
+			perm[i], perm[j] = perm[j], perm[i]
+		})
+	}
+	return p
+}
+
+// Noise returns gradient noise in [-1, 1].
+func (p *Perlin) Noise(pt math3.Vec3) float64 {
+	fx, fy, fz := math.Floor(pt.X()), math.Floor(pt.Y()), math.Floor(pt.Z())
+	u, v, w := pt.X()-fx, pt.Y()-fy, pt.Z()-fz
+	i, j, k := int(fx), int(fy), int(fz)
+
+	// hermite smoothing of the interpolation weights
+	uu := u * u * (3 - 2*u)
+	vv := v * v * (3 - 2*v)
+	ww := w * w * (3 - 2*w)
+
+	accum := 0.0
+	for di := 0; di < 2; di++ {
+		for dj := 0; dj < 2; dj++ {
+			for dk := 0; dk < 2; dk++ {
+				g := p.gradients[p.permX[(i+di)&255]^p.permY[(j+dj)&255]^p.permZ[(k+dk)&255]]
+				weight := math3.Vec3{u - float64(di), v - float64(dj), w - float64(dk)}
+				accum += lerpWeight(di, uu) * lerpWeight(dj, vv) * lerpWeight(dk, ww) * g.Dot(weight)
+			}
+		}
+	}
+	return accum
+}
+
+func (p *Perlin) Turbulence(pt math3.Vec3, depth int) float64 {
+	accum := 0.0
+	weight := 1.0
+	for i := 0; i < depth; i++ {
+		accum += weight * p.Noise(pt)
+		weight *= 0.5
+		pt = pt.Scale(2)
+	}
+	return math.Abs(accum)
+}
+
+func lerpWeight(corner int, t float64) float64 {
+	if corner == 1 {
+		return t
+	}
+	return 1 - t
+}
@@ -1,9 +1,9 @@
 package raytracer
 
 import (
-	"fmt"
-	"image"
-	"image/color"
+	"context"
+	"raytracer/imageio"
+	"raytracer/math3"
 	"sync"
 	"time"
 )
@@ -16,17 +16,24 @@ type WorkerJob struct {
 	Chunk  int
 }
 
-type ComputeFunc func(x int, y int, world *World) color.Color
+func (job WorkerJob) Pixels() int {
+	return (job.XEnd - job.XStart) * (job.YEnd - job.YStart)
+}
+
+type ComputeFunc func(x int, y int, world *World) math3.Vec3
 
 type WorkerPool struct {
 	Workers       int
 	totalJobs     int
 	remainingJobs int
+	totalPixels   int
+	pixelsDone    int
 	startTime     time.Time
 	mu            sync.Mutex
 	Jobs          chan WorkerJob
 	Wg            *sync.WaitGroup
 	World         *World
+	Progress      func(ProgressEvent)
 }
 
 func NewWorkerPool(workers int, world *World) *WorkerPool {
@@ -38,33 +45,74 @@ func NewWorkerPool(workers int, world *World) *WorkerPool {
 	}
 }
 
-func (wp *WorkerPool) Start(totalJobs int, img *image.RGBA, compute ComputeFunc) {
-	wp.totalJobs = totalJobs
-	wp.remainingJobs = totalJobs
+// Start spawns the workers and feeds them jobs until all are handed out or
+// ctx is done.
+func (wp *WorkerPool) Start(ctx context.Context, jobs []WorkerJob, img *imageio.FloatImage, compute ComputeFunc) {
+	wp.totalJobs = len(jobs)
+	wp.remainingJobs = len(jobs)
+	wp.totalPixels = 0
+	for _, job := range jobs {
+		wp.totalPixels += job.Pixels()
+	}
 	wp.startTime = time.Now()
-	for i := 0; i < wp.Workers; i++ {
+	for range max(wp.Workers, 1) {
 		wp.Wg.Add(1)
-		go wp.worker(img, compute)
+		go wp.worker(ctx, img, compute)
+	}
+	for _, job := range jobs {
+		select {
+		case wp.Jobs <- job:
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
-func (wp *WorkerPool) worker(img *image.RGBA, compute ComputeFunc) {
+func (wp *WorkerPool) worker(ctx context.Context, img *imageio.FloatImage, compute ComputeFunc) {
 	defer wp.Wg.Done()
 	for job := range wp.Jobs {
-		start := time.Now()
-		fmt.Printf("Worker picked up job %d\n", job.Chunk)
-		for y := job.YStart; y < job.YEnd; y++ {
-			for x := job.XStart; x < job.XEnd; x++ {
-				color := compute(x, y, wp.World)
-				img.Set(x, y, color)
-			}
+		if !wp.run(ctx, job, img, compute) {
+			continue
 		}
 		wp.mu.Lock()
 		wp.remainingJobs--
+		wp.pixelsDone += job.Pixels()
+		if wp.Progress != nil {
+			wp.Progress(wp.progress(job))
+		}
 		wp.mu.Unlock()
-		total := time.Since(start)
-		elapsed := time.Since(wp.startTime)
-		fmt.Printf("Worker finished job %d of %d in %s (remaining %d - time so far %s)\n", job.Chunk, wp.totalJobs, formatDuration(total), wp.remainingJobs, elapsed.String())
+	}
+}
+
+// run renders a job, it returns false if it was interrupted by ctx.
+func (wp *WorkerPool) run(ctx context.Context, job WorkerJob, img *imageio.FloatImage, compute ComputeFunc) bool {
+	for y := job.YStart; y < job.YEnd; y++ {
+		for x := job.XStart; x < job.XEnd; x++ {
+			if ctx.Err() != nil {
+				return false
+			}
+			c := compute(x, y, wp.World)
+			img.SetRGB(x, y, c[0], c[1], c[2])
+		}
+	}
+	return true
+}
+
+func (wp *WorkerPool) progress(job WorkerJob) ProgressEvent {
+	elapsed := time.Since(wp.startTime)
+	var eta time.Duration
+	if wp.pixelsDone > 0 {
+		remaining := wp.totalPixels - wp.pixelsDone
+		eta = time.Duration(float64(elapsed) * float64(remaining) / float64(wp.pixelsDone))
+	}
+	return ProgressEvent{
+		Tile:        job,
+		TilesDone:   wp.totalJobs - wp.remainingJobs,
+		TilesTotal:  wp.totalJobs,
+		PixelsDone:  wp.pixelsDone,
+		PixelsTotal: wp.totalPixels,
+		Elapsed:     elapsed,
+		ETA:         eta,
 	}
 }
 
@@ -73,36 +121,9 @@ func (wp *WorkerPool) Wait() {
 	wp.Wg.Wait()
 }
 
-func formatDuration(d time.Duration) string {
-	h := d / time.Hour
-	d -= h * time.Hour
-
-	m := d / time.Minute
-	d -= m * time.Minute
-
-	s := d / time.Second
-	d -= s * time.Second
-
-	ms := d / time.Millisecond
-	d -= ms * time.Millisecond
-
-	us := d / time.Microsecond
-
-	result := ""
-	if h > 0 {
-		result += fmt.Sprintf("%dh", h)
-	}
-	if m > 0 {
-		result += fmt.Sprintf("%dm", m)
-	}
-	if s > 0 {
-		result += fmt.Sprintf("%ds", s)
-	}
-	if ms > 0 {
-		result += fmt.Sprintf("%dms", ms)
-	}
-	if us > 0 && result == "" { // only show microseconds if it's the only value
-		result += fmt.Sprintf("%dµs", us)
-	}
-	return result
+// Finished reports whether every job was rendered, call it after Wait.
+func (wp *WorkerPool) Finished() bool {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	return wp.remainingJobs == 0
 }
@@ -0,0 +1,172 @@
+package raytracer
+
+import (
+	"context"
+	"math/rand/v2"
+	"raytracer/imageio"
+	"raytracer/math3"
+	"sync"
+	"sync/atomic"
+)
+
+// Accumulator sums the samples of every pixel across progressive passes.
+// Tiles are disjoint, so every pixel is written by one worker at a time and
+// workers share the lock, only Image, Samples and checkpoints take it
+// exclusively to read a consistent image.
+type Accumulator struct {
+	Width  int
+	Height int
+	pixels []pixelSamples
+	mu     sync.RWMutex
+}
+
+func NewAccumulator(width int, height int) *Accumulator {
+	return &Accumulator{Width: width, Height: height, pixels: make([]pixelSamples, width*height)}
+}
+
+// sample merges the samples fn takes given the pixel's current ones and
+// returns its new total. Callers must not sample the same pixel
+// concurrently.
+func (a *Accumulator) sample(x int, y int, fn func(current pixelSamples) pixelSamples) pixelSamples {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	p := &a.pixels[y*a.Width+x]
+	p.add(fn(*p))
+	return *p
+}
+
+// Image returns the current estimate, pixels without samples are left
+// transparent.
+func (a *Accumulator) Image() *imageio.FloatImage {
+	img := imageio.NewFloatImage(a.Width, a.Height)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, p := range a.pixels {
+		if p.Count > 0 {
+			c := p.mean()
+			img.Set(i%a.Width, i/a.Width, [4]float32{float32(c[0]), float32(c[1]), float32(c[2]), 1})
+		}
+	}
+	return img
+}
+
+// Samples is the total number of samples accumulated.
+func (a *Accumulator) Samples() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	total := int64(0)
+	for _, p := range a.pixels {
+		total += int64(p.Count)
+	}
+	return total
+}
+
+// Progressive refines the whole image pass by pass, every pass doubling the
+// samples per pixel (1, 2, 4, ...) until the camera's SamplesPerPixel, or
+// adaptive sampling's MaxSamples, is reached. Snapshot can be called at any
+// time while Run is in progress.
+type Progressive struct {
+	cam   *Camera
+	world *World
+	opts  RenderOptions
+	accum *Accumulator
+	// shuffles the tiles of every pass
+	rng *rand.PCG
+	mu  sync.Mutex
+	// completed passes, the samples per pixel they reached and the state of
+	// rng at the start of the next one
+	passes   int
+	reached  int
+	rngState []byte
+}
+
+func (cam *Camera) NewProgressive(world *World, opts RenderOptions) *Progressive {
+	p := &Progressive{
+		cam:   cam,
+		world: world,
+		opts:  opts,
+		accum: NewAccumulator(cam.Width, cam.Height),
+		rng:   rand.NewPCG(rand.Uint64(), rand.Uint64()),
+	}
+	p.rngState, _ = p.rng.MarshalBinary()
+	return p
+}
+
+// Snapshot returns the current estimate of the image.
+func (p *Progressive) Snapshot() *imageio.FloatImage {
+	return p.accum.Image()
+}
+
+// Passes returns the number of completed passes.
+func (p *Progressive) Passes() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.passes
+}
+
+// Run renders the passes, continuing after the last completed one. Pixels
+// only take the samples they are missing from the pass's target, so a pass
+// interrupted halfway is finished rather than repeated. AOVs other than
+// variance and samples are taken from the last pass. When ctx is done the
+// estimate so far is returned with the context's error.
+func (p *Progressive) Run(ctx context.Context) (*Frame, error) {
+	cam, opts := p.cam, p.opts
+	frame := NewFrame(cam.Width, cam.Height, opts.AOVs)
+	maxSamples := cam.SamplesPerPixel
+	if opts.Adaptive != nil {
+		maxSamples = opts.Adaptive.MaxSamples
+	}
+	samples := atomic.Int64{}
+	samples.Store(p.accum.Samples())
+	// convergence is judged on the accumulated samples, not within a pass
+	passPixel := opts
+	passPixel.Adaptive = nil
+
+	p.mu.Lock()
+	pass, done := p.passes, p.reached
+	p.mu.Unlock()
+	for ; done < maxSamples && ctx.Err() == nil; pass++ {
+		target := min(1<<pass, maxSamples)
+		passOpts := opts
+		if opts.Progress != nil {
+			passOpts.Progress = func(event ProgressEvent) {
+				event.Pass = pass + 1
+				opts.Progress(event)
+			}
+		}
+		wp := newPool(p.world, passOpts, &samples)
+		wp.Start(ctx, cam.tiles(opts.TileSize, opts.TileOrder, rand.New(p.rng)), frame.Color, func(x int, y int, world *World) math3.Vec3 {
+			return p.accum.sample(x, y, func(current pixelSamples) pixelSamples {
+				if current.Count >= target || (opts.Adaptive != nil && opts.Adaptive.belowThreshold(current)) {
+					return pixelSamples{}
+				}
+				ps := cam.samplePixel(x, y, world, passPixel, frame.AOVs, current.Count, target-current.Count)
+				samples.Add(int64(ps.Count))
+				return ps
+			}).mean()
+		})
+		wp.Wait()
+		if ctx.Err() == nil {
+			done = target
+			p.mu.Lock()
+			p.passes, p.reached = pass+1, target
+			p.rngState, _ = p.rng.MarshalBinary()
+			p.mu.Unlock()
+		}
+	}
+
+	frame.Color = p.accum.Image()
+	p.accum.mu.Lock()
+	for i, ps := range p.accum.pixels {
+		if img := frame.AOVs[AOVVariance]; img != nil {
+			v := float32(ps.variance())
+			img.Set(i%cam.Width, i/cam.Width, [4]float32{v, v, v, 1})
+		}
+		if img := frame.AOVs[AOVSamples]; img != nil {
+			n := float32(ps.Count)
+			img.Set(i%cam.Width, i/cam.Width, [4]float32{n, n, n, 1})
+		}
+	}
+	p.accum.mu.Unlock()
+	return frame, ctx.Err()
+}
@@ -0,0 +1,125 @@
+package raytracer
+
+import (
+	"context"
+	"raytracer/imageio"
+	"raytracer/math3"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+type RenderOptions struct {
+	Integrator Integrator
+	// Progress is called every time a tile finishes, calls are serialized
+	Progress func(ProgressEvent)
+	// auxiliary outputs rendered along with the color
+	AOVs []AOV
+	// nil takes the camera's SamplesPerPixel for every pixel
+	Adaptive *AdaptiveSampling
+	// goroutines rendering tiles, zero leaves one core free
+	Workers int
+	// tile edge in pixels, zero uses 32
+	TileSize int
+	// order tiles are handed out in
+	TileOrder TileOrder
+	// every sample draws from its own random sequence derived from Seed, the
+	// pixel and the sample index, so the same seed renders the same image
+	Seed uint64
+}
+
+// Frame is the result of a render, the linear color and any requested AOVs.
+type Frame struct {
+	Color *imageio.FloatImage
+	AOVs  map[AOV]*imageio.FloatImage
+}
+
+type ProgressEvent struct {
+	// pass of a progressive render counting from 1, zero otherwise
+	Pass        int
+	Tile        WorkerJob
+	TilesDone   int
+	TilesTotal  int
+	PixelsDone  int
+	PixelsTotal int
+	Samples     int64
+	Elapsed     time.Duration
+	ETA         time.Duration
+}
+
+// NewFrame allocates the color and AOV images of a render.
+func NewFrame(width int, height int, aovs []AOV) *Frame {
+	frame := &Frame{Color: imageio.NewFloatImage(width, height), AOVs: map[AOV]*imageio.FloatImage{}}
+	for _, aov := range aovs {
+		frame.AOVs[aov] = imageio.NewFloatImage(width, height)
+	}
+	return frame
+}
+
+// newPool creates a worker pool reporting progress to opts, with the
+// samples taken so far read from samples.
+func newPool(world *World, opts RenderOptions, samples *atomic.Int64) *WorkerPool {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = max(1, runtime.NumCPU()-1)
+	}
+	wp := NewWorkerPool(workers, world)
+	if opts.Progress != nil {
+		wp.Progress = func(event ProgressEvent) {
+			event.Samples = samples.Load()
+			opts.Progress(event)
+		}
+	}
+	return wp
+}
+
+// Render traces the image into a linear HDR framebuffer using a pool of
+// workers. When ctx is cancelled or its deadline passes the tiles finished
+// so far are returned along with the context's error, unless every tile
+// finished anyway.
+func (cam *Camera) Render(ctx context.Context, world *World, opts RenderOptions) (*Frame, error) {
+	frame := NewFrame(cam.Width, cam.Height, opts.AOVs)
+	samples := atomic.Int64{}
+	wp := newPool(world, opts, &samples)
+	wp.Start(ctx, cam.Tiles(opts.TileSize, opts.TileOrder), frame.Color, func(x int, y int, world *World) math3.Vec3 {
+		c, n := cam.renderPixel(x, y, world, opts, frame.AOVs)
+		samples.Add(int64(n))
+		return c
+	})
+	wp.Wait()
+	if wp.Finished() {
+		return frame, nil
+	}
+	return frame, ctx.Err()
+}
+
+// RenderTile renders the pixels of one job into frame, which covers the
+// whole image, on the calling goroutine and returns the samples taken. It
+// lets other processes render a share of the image.
+func (cam *Camera) RenderTile(ctx context.Context, frame *Frame, world *World, opts RenderOptions, job WorkerJob) (int64, error) {
+	samples := int64(0)
+	for y := job.YStart; y < job.YEnd; y++ {
+		for x := job.XStart; x < job.XEnd; x++ {
+			if ctx.Err() != nil {
+				return samples, ctx.Err()
+			}
+			c, n := cam.renderPixel(x, y, world, opts, frame.AOVs)
+			frame.Color.SetRGB(x, y, c[0], c[1], c[2])
+			samples += int64(n)
+		}
+	}
+	return samples, nil
+}
+
+// renderPixel returns the color of a pixel and the samples it took.
+func (cam *Camera) renderPixel(x int, y int, world *World, opts RenderOptions, aovs map[AOV]*imageio.FloatImage) (math3.Vec3, int) {
+	if len(aovs) == 0 && opts.Adaptive == nil {
+		return cam.RenderPixel(x, y, world, opts.Integrator, opts.Seed), cam.SamplesPerPixel
+	}
+	maxSamples := cam.SamplesPerPixel
+	if opts.Adaptive != nil {
+		maxSamples = opts.Adaptive.MaxSamples
+	}
+	ps := cam.samplePixel(x, y, world, opts, aovs, 0, maxSamples)
+	return ps.mean(), ps.Count
+}
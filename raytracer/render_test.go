@@ -0,0 +1,165 @@
+package raytracer_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"raytracer/raytracer"
+	"raytracer/scene"
+	"slices"
+	"testing"
+)
+
+func testScene(t *testing.T) (*raytracer.World, *raytracer.Camera, raytracer.RenderOptions) {
+	t.Helper()
+	doc := scene.New()
+	doc.Camera = scene.Camera{
+		Width:           32,
+		AspectRatio:     1,
+		SamplesPerPixel: 16,
+		MaxDepth:        8,
+		VFov:            40,
+		LookFrom:        scene.Vector{0, 1, 5},
+		LookAt:          scene.Vector{0, 0, 0},
+		DefocusAngle:    0.5,
+		FocusDist:       5,
+	}
+	doc.Render = scene.Render{Seed: 42, TileSize: 8}
+	doc.Materials["ground"] = scene.Material{Type: "lambertian", Albedo: scene.Vector{0.5, 0.5, 0.5}}
+	doc.Materials["red"] = scene.Material{Type: "lambertian", Albedo: scene.Vector{0.7, 0.1, 0.1}}
+	doc.Materials["glass"] = scene.Material{Type: "dielectric", RefractionIndex: 1.5}
+	doc.Materials["light"] = scene.Material{Type: "diffuse_light", Emit: scene.Vector{4, 4, 4}}
+	doc.Objects = []scene.Object{
+		{Type: "sphere", Center: scene.Vector{0, -100.5, 0}, Radius: 100, Material: "ground"},
+		{Type: "sphere", Center: scene.Vector{-0.6, 0, 0}, Radius: 0.5, Material: "red"},
+		{Type: "sphere", Center: scene.Vector{0.6, 0, 0}, Radius: 0.5, Material: "glass"},
+		{Type: "sphere", Center: scene.Vector{0, 2, 0}, Radius: 0.3, Material: "light"},
+	}
+	world, cam, err := doc.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := doc.RenderOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return world, cam, opts
+}
+
+func TestRenderIndependentOfWorkersAndTileOrder(t *testing.T) {
+	world, cam, opts := testScene(t)
+
+	opts.Workers, opts.TileOrder = 1, raytracer.TileScanline
+	serial, err := cam.Render(context.Background(), world, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Workers, opts.TileOrder = 4, raytracer.TileRandom
+	parallel, err := cam.Render(context.Background(), world, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(serial.Color.Pix, parallel.Color.Pix) {
+		t.Error("images rendered with the same seed differ")
+	}
+
+	opts.Seed++
+	reseeded, err := cam.Render(context.Background(), world, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Equal(serial.Color.Pix, reseeded.Color.Pix) {
+		t.Error("images rendered with different seeds are identical")
+	}
+}
+
+func TestProgressiveResumeContinuesSequence(t *testing.T) {
+	world, cam, opts := testScene(t)
+	opts.Workers = 4
+
+	full, err := cam.NewProgressive(world, opts).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// interrupt halfway through the pass going from 4 to 8 samples
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupted := opts
+	interrupted.Progress = func(event raytracer.ProgressEvent) {
+		if event.Pass == 4 && event.TilesDone == event.TilesTotal/2 {
+			cancel()
+		}
+	}
+	p := cam.NewProgressive(world, interrupted)
+	if _, err := p.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("interrupted render returned %v", err)
+	}
+	buf := bytes.Buffer{}
+	if err := p.Checkpoint().Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	c, err := raytracer.DecodeCheckpoint(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Passes != 3 {
+		t.Fatalf("checkpoint after %d passes, expected 3", c.Passes)
+	}
+
+	resumed := cam.NewProgressive(world, opts)
+	if err := resumed.Resume(c); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := resumed.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(full.Color.Pix, frame.Color.Pix) {
+		t.Error("resumed render differs from the uninterrupted one")
+	}
+}
+
+func TestProgressiveResumeWithMoreSamples(t *testing.T) {
+	world, cam, opts := testScene(t)
+	opts.Workers = 4
+	opts.AOVs = []raytracer.AOV{raytracer.AOVSamples}
+
+	full, err := cam.NewProgressive(world, opts).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the last pass of a 10 spp render stops short of 16
+	short := *cam
+	short.SamplesPerPixel = 10
+	p := short.NewProgressive(world, opts)
+	if _, err := p.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	c := p.Checkpoint()
+	if c.SamplesPerPixel != 10 {
+		t.Fatalf("checkpoint at %d samples per pixel, expected 10", c.SamplesPerPixel)
+	}
+
+	resumed := cam.NewProgressive(world, opts)
+	if err := resumed.Resume(c); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := resumed.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, n := range frame.AOVs[raytracer.AOVSamples].Pix {
+		if i%4 != 3 && n != 16 {
+			t.Fatalf("pixel %d has %v samples after resuming, expected 16", i/4, n)
+		}
+	}
+	// the same samples summed in different passes only differ by rounding
+	for i, v := range frame.Color.Pix {
+		if math.Abs(float64(v-full.Color.Pix[i])) > 1e-5 {
+			t.Fatalf("resumed render differs from the uninterrupted one at %d: %v, expected %v", i, v, full.Color.Pix[i])
+		}
+	}
+}
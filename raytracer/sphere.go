@@ -6,9 +6,11 @@ import (
 )
 
 type Sphere struct {
-	Center       math3.Vec3
-	Radius       float64
-	Material     Material
+	Center   math3.Vec3
+	Radius   float64
+	Material Material
+	// identifies Material in the material ID AOV, zero means unknown
+	MaterialID   int
 	RadiusSquare float64
 }
 
@@ -20,7 +22,12 @@ func (s *Sphere) Origin() math3.Vec3 {
 	return s.Center
 }
 
-func (s *Sphere) Hit(ray math3.Ray, rayT Interval) (HitRecord, bool) {
+func (s *Sphere) BoundingBox() math3.AABB {
+	r := math3.Vec3{s.Radius, s.Radius, s.Radius}
+	return math3.NewAABB(s.Center.Sub(r), s.Center.Add(r))
+}
+
+func (s *Sphere) Hit(ray math3.Ray, rayT math3.Interval) (HitRecord, bool) {
 	oc := s.Center.Sub(ray.Origin)
 	a := ray.Direction.LengthSquared()
 	h := math3.Dot(ray.Direction, oc)
@@ -42,6 +49,15 @@ func (s *Sphere) Hit(ray math3.Ray, rayT Interval) (HitRecord, bool) {
 	rec.P = ray.At(rec.T)
 	outwardNormal := rec.P.Sub(s.Center).Div(s.Radius)
 	rec.SetFaceNormal(ray, outwardNormal)
-	rec.Material = s.Material
+	rec.U, rec.V = sphereUV(outwardNormal)
+	rec.Material, rec.MaterialID = s.Material, s.MaterialID
 	return rec, true
 }
+
+// sphereUV maps a point on the unit sphere to u in [0, 1] around the Y axis
+// starting at -X, and v in [0, 1] from -Y to +Y.
+func sphereUV(p math3.Vec3) (float64, float64) {
+	theta := math.Acos(-p.Y())
+	phi := math.Atan2(-p.Z(), p.X()) + math.Pi
+	return phi / (2 * math.Pi), theta / math.Pi
+}
@@ -0,0 +1,211 @@
+package raytracer
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg" // register decoders for LoadImageTexture
+	_ "image/png"
+	"math"
+	"os"
+	"raytracer/imageio"
+	"raytracer/math3"
+)
+
+type Texture interface {
+	Value(u float64, v float64, p math3.Vec3) math3.Vec3
+}
+
+type SolidColor struct {
+	Albedo math3.Vec3
+}
+
+func (s SolidColor) Value(u float64, v float64, p math3.Vec3) math3.Vec3 {
+	return s.Albedo
+}
+
+// CheckerTexture alternates between two textures on a 3D grid of cells of
+// size Scale, so it works on any surface without texture coordinates.
+type CheckerTexture struct {
+	Scale float64
+	Even  Texture
+	Odd   Texture
+}
+
+func (c CheckerTexture) Value(u float64, v float64, p math3.Vec3) math3.Vec3 {
+	inv := 1 / c.Scale
+	sum := int(math.Floor(inv*p.X())) + int(math.Floor(inv*p.Y())) + int(math.Floor(inv*p.Z()))
+	if sum%2 == 0 {
+		return c.Even.Value(u, v, p)
+	}
+	return c.Odd.Value(u, v, p)
+}
+
+type WrapMode int
+
+const (
+	WrapRepeat WrapMode = iota
+	WrapClamp
+	WrapMirror
+)
+
+func ParseWrapMode(s string) (WrapMode, error) {
+	switch s {
+	case "", "repeat":
+		return WrapRepeat, nil
+	case "clamp":
+		return WrapClamp, nil
+	case "mirror":
+		return WrapMirror, nil
+	}
+	return WrapRepeat, fmt.Errorf("unknown wrap mode %q", s)
+}
+
+func (w WrapMode) wrap(i int, n int) int {
+	switch w {
+	case WrapClamp:
+		return min(max(i, 0), n-1)
+	case WrapMirror:
+		period := 2 * n
+		i = ((i % period) + period) % period
+		if i >= n {
+			i = period - 1 - i
+		}
+		return i
+	default:
+		return ((i % n) + n) % n
+	}
+}
+
+// ImageTexture samples an image with bilinear filtering, texels are stored
+// in linear space.
+type ImageTexture struct {
+	Width  int
+	Height int
+	Texels []math3.Vec3
+	Wrap   WrapMode
+}
+
+// LoadImageTexture reads a PNG or JPEG image, or a linear .hdr or .pfm one.
+func LoadImageTexture(path string, wrap WrapMode) (*ImageTexture, error) {
+	if imageio.IsHDRFile(path) {
+		img, err := imageio.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return NewFloatImageTexture(img, wrap), nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return NewImageTexture(img, wrap), nil
+}
+
+func NewImageTexture(img image.Image, wrap WrapMode) *ImageTexture {
+	bounds := img.Bounds()
+	tex := &ImageTexture{
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Texels: make([]math3.Vec3, bounds.Dx()*bounds.Dy()),
+		Wrap:   wrap,
+	}
+	for y := 0; y < tex.Height; y++ {
+		for x := 0; x < tex.Width; x++ {
+			r, g, b, _ := getRGBAFloats(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+			tex.Texels[y*tex.Width+x] = math3.Vec3{srgbToLinear(r), srgbToLinear(g), srgbToLinear(b)}
+		}
+	}
+	return tex
+}
+
+func NewFloatImageTexture(img *imageio.FloatImage, wrap WrapMode) *ImageTexture {
+	tex := &ImageTexture{
+		Width:  img.Width,
+		Height: img.Height,
+		Texels: make([]math3.Vec3, img.Width*img.Height),
+		Wrap:   wrap,
+	}
+	for i := range tex.Texels {
+		tex.Texels[i] = math3.Vec3{float64(img.Pix[4*i]), float64(img.Pix[4*i+1]), float64(img.Pix[4*i+2])}
+	}
+	return tex
+}
+
+func (t *ImageTexture) Value(u float64, v float64, p math3.Vec3) math3.Vec3 {
+	return t.sample(u, v, t.Wrap, t.Wrap)
+}
+
+func (t *ImageTexture) sample(u float64, v float64, wrapX WrapMode, wrapY WrapMode) math3.Vec3 {
+	if t.Width == 0 || t.Height == 0 {
+		return math3.Vec3{0, 1, 1}
+	}
+	// image rows go down while v goes up, texel centers sit at half offsets
+	x := u*float64(t.Width) - 0.5
+	y := (1-v)*float64(t.Height) - 0.5
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	ix, iy := int(x0), int(y0)
+	texel := func(x int, y int) math3.Vec3 {
+		return t.Texels[wrapY.wrap(y, t.Height)*t.Width+wrapX.wrap(x, t.Width)]
+	}
+
+	c00 := texel(ix, iy)
+	c10 := texel(ix+1, iy)
+	c01 := texel(ix, iy+1)
+	c11 := texel(ix+1, iy+1)
+	top := c00.Scale(1 - fx).Add(c10.Scale(fx))
+	bottom := c01.Scale(1 - fx).Add(c11.Scale(fx))
+	return top.Scale(1 - fy).Add(bottom.Scale(fy))
+}
+
+type NoiseStyle int
+
+const (
+	NoisePlain NoiseStyle = iota
+	NoiseTurbulence
+	NoiseMarble
+)
+
+func ParseNoiseStyle(s string) (NoiseStyle, error) {
+	switch s {
+	case "", "plain":
+		return NoisePlain, nil
+	case "turbulence":
+		return NoiseTurbulence, nil
+	case "marble":
+		return NoiseMarble, nil
+	}
+	return NoisePlain, fmt.Errorf("unknown noise style %q", s)
+}
+
+type NoiseTexture struct {
+	Noise *Perlin
+	Scale float64
+	Style NoiseStyle
+	Color math3.Vec3
+}
+
+func (n NoiseTexture) Value(u float64, v float64, p math3.Vec3) math3.Vec3 {
+	var k float64
+	switch n.Style {
+	case NoiseTurbulence:
+		k = n.Noise.Turbulence(p.Scale(n.Scale), 7)
+	case NoiseMarble:
+		k = 0.5 * (1 + math.Sin(n.Scale*p.Z()+10*n.Noise.Turbulence(p, 7)))
+	default:
+		k = 0.5 * (1 + n.Noise.Noise(p.Scale(n.Scale)))
+	}
+	return n.Color.Scale(k)
+}
+
+func srgbToLinear(c float64) float64 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
@@ -0,0 +1,125 @@
+package raytracer
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+const defaultTileSize = 32
+
+// TileOrder is the order the tiles of an image are rendered in.
+type TileOrder int
+
+const (
+	// TileRandom shuffles the tiles, so progress shows up across the whole
+	// image
+	TileRandom TileOrder = iota
+	// TileScanline goes row by row from the top left
+	TileScanline
+	// TileSpiral starts at the center and circles outwards
+	TileSpiral
+	// TileHilbert follows a Hilbert curve, keeping consecutive tiles next to
+	// each other
+	TileHilbert
+)
+
+var tileOrderNames = []string{"random", "scanline", "spiral", "hilbert"}
+
+func ParseTileOrder(s string) (TileOrder, error) {
+	if s == "" {
+		return TileRandom, nil
+	}
+	for order, name := range tileOrderNames {
+		if s == name {
+			return TileOrder(order), nil
+		}
+	}
+	return TileRandom, fmt.Errorf("unknown tile order %q", s)
+}
+
+func (o TileOrder) String() string {
+	if o < 0 || int(o) >= len(tileOrderNames) {
+		return fmt.Sprintf("TileOrder(%d)", int(o))
+	}
+	return tileOrderNames[o]
+}
+
+// Tiles splits the image into size x size jobs, zero uses the default size,
+// in the given order.
+func (cam *Camera) Tiles(size int, order TileOrder) []WorkerJob {
+	return cam.tiles(size, order, rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())))
+}
+
+// tiles is Tiles with random order shuffling with rng.
+func (cam *Camera) tiles(size int, order TileOrder, rng *rand.Rand) []WorkerJob {
+	if size <= 0 {
+		size = defaultTileSize
+	}
+	columns, rows := (cam.Width+size-1)/size, (cam.Height+size-1)/size
+	chunks := make([]WorkerJob, 0, columns*rows)
+	for y := 0; y < cam.Height; y += size {
+		for x := 0; x < cam.Width; x += size {
+			chunks = append(chunks, WorkerJob{
+				XStart: x,
+				YStart: y,
+				XEnd:   min(x+size, cam.Width),
+				YEnd:   min(y+size, cam.Height),
+				Chunk:  len(chunks),
+			})
+		}
+	}
+
+	switch order {
+	case TileRandom:
+		rng.Shuffle(len(chunks), func(i, j int) {
+			chunks[i], chunks[j] = chunks[j], chunks[i]
+		})
+	case TileSpiral:
+		// rings of tiles around the center, each walked by angle
+		cx, cy := float64(columns-1)/2, float64(rows-1)/2
+		key := func(job WorkerJob) (float64, float64) {
+			dx, dy := float64(job.Chunk%columns)-cx, float64(job.Chunk/columns)-cy
+			return math.Round(max(math.Abs(dx), math.Abs(dy))), math.Atan2(dy, dx)
+		}
+		slices.SortStableFunc(chunks, func(a, b WorkerJob) int {
+			ringA, angleA := key(a)
+			ringB, angleB := key(b)
+			return cmp.Or(cmp.Compare(ringA, ringB), cmp.Compare(angleA, angleB))
+		})
+	case TileHilbert:
+		n := 1
+		for n < max(columns, rows) {
+			n *= 2
+		}
+		slices.SortStableFunc(chunks, func(a, b WorkerJob) int {
+			return cmp.Compare(hilbertIndex(n, a.Chunk%columns, a.Chunk/columns), hilbertIndex(n, b.Chunk%columns, b.Chunk/columns))
+		})
+	}
+	return chunks
+}
+
+// hilbertIndex is the distance of (x, y) along the Hilbert curve filling an
+// n x n grid, n a power of two.
+func hilbertIndex(n int, x int, y int) int {
+	d := 0
+	for s := n / 2; s > 0; s /= 2 {
+		rx, ry := 0, 0
+		if x&s > 0 {
+			rx = 1
+		}
+		if y&s > 0 {
+			ry = 1
+		}
+		d += s * s * ((3 * rx) ^ ry)
+		if ry == 0 {
+			if rx == 1 {
+				x, y = n-1-x, n-1-y
+			}
+			x, y = y, x
+		}
+	}
+	return d
+}
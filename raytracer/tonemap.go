@@ -0,0 +1,157 @@
+package raytracer
+
+import (
+	"fmt"
+	"math"
+	"raytracer/imageio"
+	"raytracer/math3"
+)
+
+type ToneMapOperator int
+
+const (
+	// ToneMapClamp leaves the exposed colors untouched, anything above 1
+	// clips when quantized
+	ToneMapClamp ToneMapOperator = iota
+	ToneMapReinhard
+	ToneMapReinhardExtended
+	ToneMapHable
+	ToneMapACES
+)
+
+func ParseToneMapOperator(s string) (ToneMapOperator, error) {
+	switch s {
+	case "", "clamp":
+		return ToneMapClamp, nil
+	case "reinhard":
+		return ToneMapReinhard, nil
+	case "reinhard_extended":
+		return ToneMapReinhardExtended, nil
+	case "hable":
+		return ToneMapHable, nil
+	case "aces":
+		return ToneMapACES, nil
+	}
+	return ToneMapClamp, fmt.Errorf("unknown tone mapping operator %q", s)
+}
+
+func (op ToneMapOperator) String() string {
+	switch op {
+	case ToneMapReinhard:
+		return "reinhard"
+	case ToneMapReinhardExtended:
+		return "reinhard_extended"
+	case ToneMapHable:
+		return "hable"
+	case ToneMapACES:
+		return "aces"
+	default:
+		return "clamp"
+	}
+}
+
+// ToneMapper compresses scene referred radiance into the displayable [0, 1]
+// range, the result is still linear and gets encoded to sRGB on output.
+type ToneMapper struct {
+	Operator ToneMapOperator
+	// exposure adjustment in stops, every step doubles the brightness
+	Exposure float64
+	// smallest value mapped to pure white by the extended Reinhard and Hable
+	// curves, zero picks the brightest pixel and the Hable default of 11.2
+	// respectively
+	WhitePoint float64
+}
+
+// Apply returns a tone mapped copy of img, alpha is kept as is.
+func (t ToneMapper) Apply(img *imageio.FloatImage) *imageio.FloatImage {
+	if t.Operator == ToneMapReinhardExtended && t.WhitePoint <= 0 {
+		t.WhitePoint = maxLuminance(img, math.Exp2(t.Exposure))
+	}
+	out := imageio.NewFloatImage(img.Width, img.Height)
+	for i := 0; i < len(img.Pix); i += 4 {
+		c := t.Map(math3.Vec3{float64(img.Pix[i]), float64(img.Pix[i+1]), float64(img.Pix[i+2])})
+		out.Pix[i], out.Pix[i+1], out.Pix[i+2] = float32(c[0]), float32(c[1]), float32(c[2])
+		out.Pix[i+3] = img.Pix[i+3]
+	}
+	return out
+}
+
+func (t ToneMapper) Map(c math3.Vec3) math3.Vec3 {
+	c = c.Scale(math.Exp2(t.Exposure))
+	switch t.Operator {
+	case ToneMapReinhard:
+		return math3.Vec3{c[0] / (1 + c[0]), c[1] / (1 + c[1]), c[2] / (1 + c[2])}
+	case ToneMapReinhardExtended:
+		return reinhardExtended(c, t.WhitePoint)
+	case ToneMapHable:
+		white := t.WhitePoint
+		if white <= 0 {
+			white = 11.2
+		}
+		// the curve is meant to be fed with a two stop exposure bias
+		scale := 1 / hable(white)
+		return math3.Vec3{hable(2*c[0]) * scale, hable(2*c[1]) * scale, hable(2*c[2]) * scale}
+	case ToneMapACES:
+		return acesFitted(c)
+	default:
+		return c
+	}
+}
+
+func luminance(c math3.Vec3) float64 {
+	return 0.2126*c[0] + 0.7152*c[1] + 0.0722*c[2]
+}
+
+func maxLuminance(img *imageio.FloatImage, scale float64) float64 {
+	white := 0.0
+	for i := 0; i < len(img.Pix); i += 4 {
+		white = max(white, scale*luminance(math3.Vec3{float64(img.Pix[i]), float64(img.Pix[i+1]), float64(img.Pix[i+2])}))
+	}
+	return white
+}
+
+// reinhardExtended maps luminance so that white ends up at exactly 1 and
+// rescales the color to keep its hue.
+func reinhardExtended(c math3.Vec3, white float64) math3.Vec3 {
+	l := luminance(c)
+	if l <= 0 || white <= 0 {
+		return math3.Vec3{}
+	}
+	mapped := l * (1 + l/(white*white)) / (1 + l)
+	return c.Scale(mapped / l)
+}
+
+// hable is John Hable's filmic curve from Uncharted 2.
+func hable(x float64) float64 {
+	const a, b, c, d, e, f = 0.15, 0.50, 0.10, 0.20, 0.02, 0.30
+	x = max(x, 0)
+	return (x*(a*x+c*b)+d*e)/(x*(a*x+b)+d*f) - e/f
+}
+
+// acesFitted is Stephen Hill's fit of the ACES reference rendering and
+// output transforms, working in the sRGB primaries.
+func acesFitted(c math3.Vec3) math3.Vec3 {
+	input := [3]math3.Vec3{
+		{0.59719, 0.35458, 0.04823},
+		{0.07600, 0.90834, 0.01566},
+		{0.02840, 0.13383, 0.83777},
+	}
+	output := [3]math3.Vec3{
+		{1.60475, -0.53108, -0.07367},
+		{-0.10208, 1.10813, -0.00605},
+		{-0.00327, -0.07276, 1.07602},
+	}
+	v := math3.Vec3{math3.Dot(input[0], c), math3.Dot(input[1], c), math3.Dot(input[2], c)}
+	for i, x := range v {
+		v[i] = (x*(x+0.0245786) - 0.000090537) / (x*(0.983729*x+0.4329510) + 0.238081)
+	}
+	return math3.Vec3{math3.Dot(output[0], v), math3.Dot(output[1], v), math3.Dot(output[2], v)}
+}
+
+// linearToSRGB is the sRGB opto-electronic transfer function.
+func linearToSRGB(val float64) float64 {
+	if val <= 0.0031308 {
+		return 12.92 * max(val, 0)
+	}
+	return 1.055*math.Pow(val, 1/2.4) - 0.055
+}
@@ -0,0 +1,79 @@
+package raytracer
+
+import (
+	"math"
+	"raytracer/math3"
+)
+
+const triangleEpsilon = 1e-12
+
+type Triangle struct {
+	V0       math3.Vec3
+	V1       math3.Vec3
+	V2       math3.Vec3
+	Material Material
+	// identifies Material in the material ID AOV, zero means unknown
+	MaterialID int
+	edge1      math3.Vec3
+	edge2      math3.Vec3
+}
+
+func (t *Triangle) Prepare() {
+	t.edge1 = t.V1.Sub(t.V0)
+	t.edge2 = t.V2.Sub(t.V0)
+}
+
+func (t *Triangle) Origin() math3.Vec3 {
+	return t.V0.Add(t.V1).Add(t.V2).Div(3)
+}
+
+func (t *Triangle) BoundingBox() math3.AABB {
+	return math3.NewAABB(t.V0, t.V1).Extend(t.V2).Pad(1e-4)
+}
+
+func (t *Triangle) Hit(ray math3.Ray, rayT math3.Interval) (HitRecord, bool) {
+	root, u, v, ok := intersectTriangle(ray, t.V0, t.edge1, t.edge2, rayT)
+	if !ok {
+		return HitRecord{}, false
+	}
+	rec := HitRecord{}
+	rec.T = root
+	rec.P = ray.At(root)
+	rec.SetFaceNormal(ray, math3.Cross(t.edge1, t.edge2).Normalize())
+	rec.U, rec.V = u, v
+	rec.Barycentric = math3.Vec3{1 - u - v, u, v}
+	rec.Material, rec.MaterialID = t.Material, t.MaterialID
+	return rec, true
+}
+
+// intersectTriangle is the Möller–Trumbore test, it returns the ray parameter
+// and the barycentric coordinates of the hit relative to v1 and v2.
+func intersectTriangle(
+	ray math3.Ray,
+	v0 math3.Vec3,
+	edge1 math3.Vec3,
+	edge2 math3.Vec3,
+	rayT math3.Interval,
+) (float64, float64, float64, bool) {
+	pvec := math3.Cross(ray.Direction, edge2)
+	det := math3.Dot(edge1, pvec)
+	if math.Abs(det) < triangleEpsilon {
+		return 0, 0, 0, false
+	}
+	invDet := 1 / det
+	tvec := ray.Origin.Sub(v0)
+	u := math3.Dot(tvec, pvec) * invDet
+	if u < 0 || u > 1 {
+		return 0, 0, 0, false
+	}
+	qvec := math3.Cross(tvec, edge1)
+	v := math3.Dot(ray.Direction, qvec) * invDet
+	if v < 0 || u+v > 1 {
+		return 0, 0, 0, false
+	}
+	t := math3.Dot(edge2, qvec) * invDet
+	if !rayT.Surrounds(t) {
+		return 0, 0, 0, false
+	}
+	return t, u, v, true
+}
@@ -2,42 +2,61 @@ package raytracer
 
 import (
 	"raytracer/math3"
-	"slices"
 )
 
 type World struct {
 	Objects []Hittable
+	// emitters sampled directly when shading, they are also part of Objects
+	Lights []Light
+	// color of rays escaping the scene, nil uses the sky gradient
+	Background Background
+	bvh        *BVH
 }
 
 func (w *World) Clear() {
 	w.Objects = make([]Hittable, 0)
+	w.Lights = nil
+	w.bvh = nil
 }
 
 func (w *World) Add(obj Hittable) {
 	w.Objects = append(w.Objects, obj)
+	w.bvh = nil
+}
+
+func (w *World) AddLight(light Light) {
+	w.Add(light)
+	w.Lights = append(w.Lights, light)
 }
 
 func (w *World) Prepare() {
 	for _, obj := range w.Objects {
 		obj.Prepare()
 	}
-	// closest first should lead to less iterations
-	slices.SortFunc(w.Objects, func(a Hittable, b Hittable) int {
-		return int(a.Origin().Z() - b.Origin().Z())
-	})
-
+	w.bvh = NewBVH(w.Objects)
 }
 
-func (w *World) Hit(ray math3.Ray, rayT Interval) (HitRecord, bool) {
+func (w *World) Hit(ray math3.Ray, rayT math3.Interval) (HitRecord, bool) {
+	if w.bvh != nil {
+		return w.bvh.Hit(ray, rayT)
+	}
 	hitAnything := false
 	closestSoFar := rayT.Max
 	rec := HitRecord{}
-	for _, obj := range w.Objects {
-		if localRec, hasHit := obj.Hit(ray, Interval{Min: rayT.Min, Max: closestSoFar}); hasHit {
+	for i, obj := range w.Objects {
+		if localRec, hasHit := obj.Hit(ray, math3.Interval{Min: rayT.Min, Max: closestSoFar}); hasHit {
 			hitAnything = true
 			closestSoFar = localRec.T
 			rec = localRec
+			rec.Object = i
 		}
 	}
 	return rec, hitAnything
 }
+
+func (w *World) BackgroundColor(ray math3.Ray) math3.Vec3 {
+	if w.Background == nil {
+		return SkyGradient{}.Color(ray)
+	}
+	return w.Background.Color(ray)
+}
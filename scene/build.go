@@ -0,0 +1,487 @@
+package scene
+
+import (
+	"errors"
+	"fmt"
+	"raytracer/imageio"
+	"raytracer/math3"
+	"raytracer/raytracer"
+	"raytracer/wavefront"
+	"slices"
+)
+
+type builder struct {
+	scene     *Scene
+	textures  map[string]raytracer.Texture
+	materials map[string]raytracer.Material
+	// material IDs, the scene's materials are numbered from 1 in name order
+	// and the materials of models after them
+	materialIDs    map[string]int
+	lastMaterialID int
+	errs           []error
+	warnings       []error
+}
+
+// Build validates the scene and creates the world and camera it describes,
+// every problem found is reported with the path of the offending field.
+// Problems the render can go on with are kept for Warnings.
+func (s *Scene) Build() (*raytracer.World, *raytracer.Camera, error) {
+	b := &builder{
+		scene:       s,
+		textures:    map[string]raytracer.Texture{},
+		materials:   map[string]raytracer.Material{},
+		materialIDs: map[string]int{},
+	}
+	params := b.camera(s.Camera)
+	b.render(s.Render)
+	background := b.background(s.Background)
+
+	for _, name := range sortedKeys(s.Textures) {
+		if t := b.texture("textures."+name, s.Textures[name]); t != nil {
+			b.textures[name] = t
+		}
+	}
+	for _, name := range sortedKeys(s.Materials) {
+		if m := b.material("materials."+name, s.Materials[name]); m != nil {
+			b.materials[name] = m
+		}
+		b.lastMaterialID++
+		b.materialIDs[name] = b.lastMaterialID
+	}
+
+	world := &raytracer.World{Background: background}
+	for i, obj := range s.Objects {
+		b.object(world, fmt.Sprintf("objects[%d]", i), obj)
+	}
+	s.warnings = b.warnings
+	if len(b.errs) > 0 {
+		return nil, nil, errors.Join(b.errs...)
+	}
+	world.Prepare()
+	return world, raytracer.NewCamera(params), nil
+}
+
+// CameraParams validates the camera settings alone, to change the view
+// without building the world again.
+func (s *Scene) CameraParams() (raytracer.CameraParams, error) {
+	b := &builder{scene: s}
+	params := b.camera(s.Camera)
+	if len(b.errs) > 0 {
+		return raytracer.CameraParams{}, errors.Join(b.errs...)
+	}
+	return params, nil
+}
+
+// Integrator creates the light transport algorithm selected by the render
+// settings, using the camera's maximum depth.
+func (s *Scene) Integrator() (raytracer.Integrator, error) {
+	integrator, err := raytracer.NewIntegrator(s.Render.Integrator, s.Camera.MaxDepth)
+	if err != nil {
+		return nil, &PathError{Path: "render.integrator", Err: err}
+	}
+	if ao, ok := integrator.(raytracer.AmbientOcclusion); ok {
+		ao.Distance = s.Render.AODistance
+		integrator = ao
+	}
+	return integrator, nil
+}
+
+// AOVs lists the auxiliary outputs requested by the render settings.
+func (s *Scene) AOVs() ([]raytracer.AOV, error) {
+	aovs := make([]raytracer.AOV, 0, len(s.Render.AOVs))
+	for i, name := range s.Render.AOVs {
+		aov, err := raytracer.ParseAOV(name)
+		if err != nil {
+			return nil, &PathError{Path: fmt.Sprintf("render.aovs[%d]", i), Err: err}
+		}
+		aovs = append(aovs, aov)
+	}
+	return aovs, nil
+}
+
+// AdaptiveSampling returns the adaptive sampling settings with defaults
+// filled in, nil when every pixel takes the camera's samples per pixel.
+func (s *Scene) AdaptiveSampling() *raytracer.AdaptiveSampling {
+	a := s.Render.Adaptive
+	if a == nil {
+		return nil
+	}
+	adaptive := &raytracer.AdaptiveSampling{Threshold: a.Threshold, MinSamples: a.MinSamples, MaxSamples: a.MaxSamples}
+	if adaptive.MaxSamples == 0 {
+		adaptive.MaxSamples = s.Camera.SamplesPerPixel
+	}
+	if adaptive.MinSamples == 0 {
+		adaptive.MinSamples = min(16, adaptive.MaxSamples)
+	}
+	return adaptive
+}
+
+// RenderOptions returns the options shared by every render of the scene:
+// the integrator, adaptive sampling and how the image is split into tiles.
+func (s *Scene) RenderOptions() (raytracer.RenderOptions, error) {
+	integrator, err := s.Integrator()
+	if err != nil {
+		return raytracer.RenderOptions{}, err
+	}
+	order, err := raytracer.ParseTileOrder(s.Render.TileOrder)
+	if err != nil {
+		return raytracer.RenderOptions{}, &PathError{Path: "render.tileOrder", Err: err}
+	}
+	return raytracer.RenderOptions{
+		Integrator: integrator,
+		Adaptive:   s.AdaptiveSampling(),
+		Workers:    s.Render.Threads,
+		TileSize:   s.Render.TileSize,
+		TileOrder:  order,
+		Seed:       s.Render.Seed,
+	}, nil
+}
+
+// ToneMapper creates the display transform selected by the render settings.
+func (s *Scene) ToneMapper() (raytracer.ToneMapper, error) {
+	op, err := raytracer.ParseToneMapOperator(s.Render.ToneMap)
+	if err != nil {
+		return raytracer.ToneMapper{}, &PathError{Path: "render.toneMap", Err: err}
+	}
+	return raytracer.ToneMapper{Operator: op, Exposure: s.Render.Exposure, WhitePoint: s.Render.WhitePoint}, nil
+}
+
+func (b *builder) fail(path string, format string, args ...any) {
+	b.errs = append(b.errs, &PathError{Path: path, Err: fmt.Errorf(format, args...)})
+}
+
+func (b *builder) vector(path string, v Vector) math3.Vec3 {
+	if v == nil {
+		b.fail(path, "missing")
+		return math3.Vec3{}
+	}
+	if len(v) != 3 {
+		b.fail(path, "expected 3 components, got %d", len(v))
+		return math3.Vec3{}
+	}
+	return math3.Vec3{v[0], v[1], v[2]}
+}
+
+func (b *builder) positive(path string, v float64) {
+	if v <= 0 {
+		b.fail(path, "must be positive, got %g", v)
+	}
+}
+
+func (b *builder) nonNegative(path string, v float64) {
+	if v < 0 {
+		b.fail(path, "must not be negative, got %g", v)
+	}
+}
+
+func (b *builder) camera(c Camera) raytracer.CameraParams {
+	params := raytracer.CameraParams{
+		Width:           c.Width,
+		AspectRatio:     c.AspectRatio,
+		SamplesPerPixel: c.SamplesPerPixel,
+		MaxDepth:        c.MaxDepth,
+		VFov:            c.VFov,
+		LookFrom:        b.vector("camera.lookFrom", c.LookFrom),
+		LookAt:          b.vector("camera.lookAt", c.LookAt),
+		DefocusAngle:    c.DefocusAngle,
+		FocusDist:       c.FocusDist,
+	}
+	b.positive("camera.width", float64(c.Width))
+	b.positive("camera.aspectRatio", c.AspectRatio)
+	b.positive("camera.samplesPerPixel", float64(c.SamplesPerPixel))
+	b.positive("camera.maxDepth", float64(c.MaxDepth))
+	b.positive("camera.focusDist", c.FocusDist)
+	if c.VFov <= 0 || c.VFov >= 180 {
+		b.fail("camera.vfov", "must be between 0 and 180 degrees, got %g", c.VFov)
+	}
+	b.nonNegative("camera.defocusAngle", c.DefocusAngle)
+	if params.LookFrom == params.LookAt {
+		b.fail("camera.lookAt", "must differ from lookFrom")
+	}
+	return params
+}
+
+func (b *builder) render(r Render) {
+	if _, err := raytracer.NewIntegrator(r.Integrator, 1); err != nil {
+		b.errs = append(b.errs, &PathError{Path: "render.integrator", Err: err})
+	}
+	if _, err := imageio.ParseEXRCompression(r.EXRCompression); err != nil {
+		b.errs = append(b.errs, &PathError{Path: "render.exrCompression", Err: err})
+	}
+	if _, err := raytracer.ParseToneMapOperator(r.ToneMap); err != nil {
+		b.errs = append(b.errs, &PathError{Path: "render.toneMap", Err: err})
+	}
+	if _, err := raytracer.ParseDither(r.Dither); err != nil {
+		b.errs = append(b.errs, &PathError{Path: "render.dither", Err: err})
+	}
+	if r.BitDepth != 0 && r.BitDepth != 8 && r.BitDepth != 16 {
+		b.fail("render.bitDepth", "must be 8 or 16, got %d", r.BitDepth)
+	}
+	for i, name := range r.AOVs {
+		if _, err := raytracer.ParseAOV(name); err != nil {
+			b.errs = append(b.errs, &PathError{Path: fmt.Sprintf("render.aovs[%d]", i), Err: err})
+		}
+		if slices.Index(r.AOVs, name) < i {
+			b.fail(fmt.Sprintf("render.aovs[%d]", i), "duplicate %q", name)
+		}
+	}
+	if len(r.AOVs) > 0 && r.AOVOutput == "" {
+		b.fail("render.aovOutput", "missing")
+	}
+	b.nonNegative("render.whitePoint", r.WhitePoint)
+	b.nonNegative("render.snapshotInterval", r.SnapshotInterval)
+	if r.SnapshotInterval > 0 && !r.Progressive {
+		b.fail("render.snapshotInterval", "requires progressive rendering")
+	}
+	b.nonNegative("render.checkpointInterval", r.CheckpointInterval)
+	b.nonNegative("render.threads", float64(r.Threads))
+	b.nonNegative("render.tileSize", float64(r.TileSize))
+	if _, err := raytracer.ParseTileOrder(r.TileOrder); err != nil {
+		b.errs = append(b.errs, &PathError{Path: "render.tileOrder", Err: err})
+	}
+	if r.Checkpoint != "" && !r.Progressive {
+		b.fail("render.checkpoint", "requires progressive rendering")
+	}
+	if a := r.Adaptive; a != nil {
+		b.positive("render.adaptive.threshold", a.Threshold)
+		b.nonNegative("render.adaptive.minSamples", float64(a.MinSamples))
+		b.nonNegative("render.adaptive.maxSamples", float64(a.MaxSamples))
+		switch spp := b.scene.Camera.SamplesPerPixel; {
+		case a.MaxSamples > 0 && a.MinSamples > a.MaxSamples:
+			b.fail("render.adaptive.minSamples", "must not exceed maxSamples (%d), got %d", a.MaxSamples, a.MinSamples)
+		case a.MaxSamples == 0 && a.MinSamples > spp:
+			b.fail("render.adaptive.minSamples", "must not exceed camera.samplesPerPixel (%d) used as maxSamples, got %d", spp, a.MinSamples)
+		}
+	}
+	b.nonNegative("render.aoDistance", r.AODistance)
+	if d := r.Denoise; d != nil {
+		switch d.Type {
+		case "", "bilateral":
+			b.positive("render.denoise.spatialSigma", d.SpatialSigma)
+			b.positive("render.denoise.rangeSigma", d.RangeSigma)
+		case "joint":
+			b.positive("render.denoise.spatialSigma", d.SpatialSigma)
+			b.nonNegative("render.denoise.rangeSigma", d.RangeSigma)
+			b.nonNegative("render.denoise.albedoSigma", d.AlbedoSigma)
+			b.nonNegative("render.denoise.normalSigma", d.NormalSigma)
+			b.nonNegative("render.denoise.depthSigma", d.DepthSigma)
+		case "atrous":
+			b.nonNegative("render.denoise.rangeSigma", d.RangeSigma)
+			b.nonNegative("render.denoise.normalSigma", d.NormalSigma)
+			b.nonNegative("render.denoise.depthSigma", d.DepthSigma)
+			b.nonNegative("render.denoise.iterations", float64(d.Iterations))
+		case "nlm":
+			b.nonNegative("render.denoise.searchRadius", float64(d.SearchRadius))
+			b.nonNegative("render.denoise.patchRadius", float64(d.PatchRadius))
+			b.nonNegative("render.denoise.strength", d.Strength)
+		default:
+			b.fail("render.denoise.type", "unknown %q", d.Type)
+		}
+	}
+}
+
+func (b *builder) background(bg *Background) raytracer.Background {
+	if bg == nil {
+		return nil
+	}
+	switch bg.Type {
+	case "sky":
+		return raytracer.SkyGradient{}
+	case "color":
+		return raytracer.SolidBackground{Radiance: b.vector("background.color", bg.Color)}
+	case "environment":
+		if bg.File == "" {
+			b.fail("background.file", "missing")
+			return nil
+		}
+		tex, err := raytracer.LoadImageTexture(b.scene.resolve(bg.File), raytracer.WrapRepeat)
+		if err != nil {
+			b.errs = append(b.errs, &PathError{Path: "background.file", Err: err})
+			return nil
+		}
+		return raytracer.EnvironmentMap{Texture: tex, Rotation: bg.Rotation}
+	case "":
+		b.fail("background.type", "missing")
+	default:
+		b.fail("background.type", "unknown %q", bg.Type)
+	}
+	return nil
+}
+
+func (b *builder) texture(path string, t Texture) raytracer.Texture {
+	color := func() math3.Vec3 {
+		if t.Color == nil {
+			return math3.Vec3{1, 1, 1}
+		}
+		return b.vector(path+".color", t.Color)
+	}
+	switch t.Type {
+	case "solid":
+		return raytracer.SolidColor{Albedo: b.vector(path+".color", t.Color)}
+	case "checker":
+		b.positive(path+".scale", t.Scale)
+		return raytracer.CheckerTexture{
+			Scale: t.Scale,
+			Even:  raytracer.SolidColor{Albedo: b.vector(path+".even", t.Even)},
+			Odd:   raytracer.SolidColor{Albedo: b.vector(path+".odd", t.Odd)},
+		}
+	case "image":
+		wrap, err := raytracer.ParseWrapMode(t.Wrap)
+		if err != nil {
+			b.errs = append(b.errs, &PathError{Path: path + ".wrap", Err: err})
+		}
+		if t.File == "" {
+			b.fail(path+".file", "missing")
+			return nil
+		}
+		tex, err := raytracer.LoadImageTexture(b.scene.resolve(t.File), wrap)
+		if err != nil {
+			b.errs = append(b.errs, &PathError{Path: path + ".file", Err: err})
+			return nil
+		}
+		return tex
+	case "noise":
+		style, err := raytracer.ParseNoiseStyle(t.Style)
+		if err != nil {
+			b.errs = append(b.errs, &PathError{Path: path + ".style", Err: err})
+		}
+		b.positive(path+".scale", t.Scale)
+		return raytracer.NoiseTexture{Noise: raytracer.NewPerlin(t.Seed), Scale: t.Scale, Style: style, Color: color()}
+	case "":
+		b.fail(path+".type", "missing")
+	default:
+		b.fail(path+".type", "unknown %q", t.Type)
+	}
+	return nil
+}
+
+// color resolves a material input given either as a constant color or as
+// the name of a texture.
+func (b *builder) color(path string, field string, v Vector, texture string) raytracer.Texture {
+	if texture == "" {
+		return raytracer.SolidColor{Albedo: b.vector(path+"."+field, v)}
+	}
+	if v != nil {
+		b.fail(path+"."+field, "cannot be combined with texture")
+	}
+	if _, declared := b.scene.Textures[texture]; !declared {
+		b.fail(path+".texture", "unknown %q", texture)
+	}
+	return b.textures[texture]
+}
+
+func (b *builder) material(path string, m Material) raytracer.Material {
+	switch m.Type {
+	case "lambertian":
+		return raytracer.Lambertian{Albedo: b.color(path, "albedo", m.Albedo, m.Texture)}
+	case "metal":
+		if m.Fuzz < 0 || m.Fuzz > 1 {
+			b.fail(path+".fuzz", "must be between 0 and 1, got %g", m.Fuzz)
+		}
+		return raytracer.Metal{Albedo: b.color(path, "albedo", m.Albedo, m.Texture), Fuzz: m.Fuzz}
+	case "dielectric":
+		b.positive(path+".refractionIndex", m.RefractionIndex)
+		return raytracer.Dialectric{RefractionIndex: m.RefractionIndex}
+	case "diffuse_light":
+		return raytracer.DiffuseLight{Emit: b.color(path, "emit", m.Emit, m.Texture)}
+	case "":
+		b.fail(path+".type", "missing")
+	default:
+		b.fail(path+".type", "unknown %q", m.Type)
+	}
+	return nil
+}
+
+func (b *builder) lookupMaterial(path string, name string) raytracer.Material {
+	if name == "" {
+		b.fail(path, "missing")
+		return nil
+	}
+	if _, declared := b.scene.Materials[name]; !declared {
+		b.fail(path, "unknown %q", name)
+	}
+	return b.materials[name]
+}
+
+func (b *builder) object(world *raytracer.World, path string, obj Object) {
+	switch obj.Type {
+	case "sphere":
+		b.positive(path+".radius", obj.Radius)
+		material := b.lookupMaterial(path+".material", obj.Material)
+		addObject(world, &raytracer.Sphere{
+			Center:     b.vector(path+".center", obj.Center),
+			Radius:     obj.Radius,
+			Material:   material,
+			MaterialID: b.materialIDs[obj.Material],
+		}, material)
+	case "triangle":
+		if len(obj.Vertices) != 3 {
+			b.fail(path+".vertices", "expected 3 vertices, got %d", len(obj.Vertices))
+			return
+		}
+		material := b.lookupMaterial(path+".material", obj.Material)
+		addObject(world, &raytracer.Triangle{
+			V0:         b.vector(path+".vertices[0]", obj.Vertices[0]),
+			V1:         b.vector(path+".vertices[1]", obj.Vertices[1]),
+			V2:         b.vector(path+".vertices[2]", obj.Vertices[2]),
+			Material:   material,
+			MaterialID: b.materialIDs[obj.Material],
+		}, material)
+	case "obj":
+		b.model(world, path, obj)
+	case "":
+		b.fail(path+".type", "missing")
+	default:
+		b.fail(path+".type", "unknown %q", obj.Type)
+	}
+}
+
+// model loads an OBJ file, a material on the object overrides the ones
+// from the model's material libraries.
+func (b *builder) model(world *raytracer.World, path string, obj Object) {
+	if obj.File == "" {
+		b.fail(path+".file", "missing")
+		return
+	}
+	var override raytracer.Material
+	if obj.Material != "" {
+		override = b.lookupMaterial(path+".material", obj.Material)
+	}
+	model, err := wavefront.LoadModel(b.scene.resolve(obj.File))
+	if err != nil {
+		b.errs = append(b.errs, &PathError{Path: path + ".file", Err: err})
+		return
+	}
+	first := b.lastMaterialID
+	for _, err := range model.Warnings {
+		b.warnings = append(b.warnings, &PathError{Path: path + ".file", Err: err})
+	}
+	for _, mesh := range model.Meshes() {
+		if override != nil {
+			mesh.Material, mesh.MaterialID = override, b.materialIDs[obj.Material]
+		} else {
+			mesh.MaterialID += first
+			b.lastMaterialID = max(b.lastMaterialID, mesh.MaterialID)
+		}
+		world.Add(mesh)
+	}
+}
+
+// addObject registers emissive primitives as lights so they are sampled
+// directly.
+func addObject(world *raytracer.World, obj raytracer.Light, material raytracer.Material) {
+	if _, emissive := material.(raytracer.Emitter); emissive {
+		world.AddLight(obj)
+		return
+	}
+	world.Add(obj)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
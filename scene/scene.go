@@ -0,0 +1,364 @@
+package scene
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const Version = 1
+
+// Scene is the on-disk description of a render, Build turns it into a
+// raytracer.World and raytracer.Camera.
+type Scene struct {
+	Version    int                 `json:"version"`
+	Camera     Camera              `json:"camera"`
+	Render     Render              `json:"render"`
+	Background *Background         `json:"background,omitempty"`
+	Textures   map[string]Texture  `json:"textures,omitempty"`
+	Materials  map[string]Material `json:"materials"`
+	Objects    []Object            `json:"objects"`
+	// directory relative file references (e.g. obj models) are resolved from
+	dir string
+	// from the last Build
+	warnings []error
+}
+
+type Vector []float64
+
+// PathError reports a problem with a field of the document, Path uses the
+// JSON names (e.g. objects[12].material).
+type PathError struct {
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+type Camera struct {
+	Width           int     `json:"width"`
+	AspectRatio     float64 `json:"aspectRatio"`
+	SamplesPerPixel int     `json:"samplesPerPixel"`
+	MaxDepth        int     `json:"maxDepth"`
+	VFov            float64 `json:"vfov"`
+	LookFrom        Vector  `json:"lookFrom"`
+	LookAt          Vector  `json:"lookAt"`
+	DefocusAngle    float64 `json:"defocusAngle"`
+	FocusDist       float64 `json:"focusDist"`
+}
+
+type Render struct {
+	Output  string   `json:"output,omitempty"`
+	Denoise *Denoise `json:"denoise,omitempty"`
+	// path (default), direct, ao or normals
+	Integrator string  `json:"integrator,omitempty"`
+	AODistance float64 `json:"aoDistance,omitempty"`
+	// linear framebuffer output (.exr) written next to the display image
+	HDROutput      string `json:"hdrOutput,omitempty"`
+	EXRCompression string `json:"exrCompression,omitempty"`
+	// display transform: clamp (default), reinhard, reinhard_extended, hable
+	// or aces, after an exposure adjustment in stops
+	ToneMap    string  `json:"toneMap,omitempty"`
+	Exposure   float64 `json:"exposure,omitempty"`
+	WhitePoint float64 `json:"whitePoint,omitempty"`
+	// PNG quantization: 8 (default) or 16 bits per channel, dithered with
+	// none (default), ordered or bluenoise
+	BitDepth int    `json:"bitDepth,omitempty"`
+	Dither   string `json:"dither,omitempty"`
+	// auxiliary outputs (albedo, normal, depth, position, material_id,
+	// object_id), written as layers of an .exr or as one .hdr/.pfm each
+	AOVs      []string  `json:"aovs,omitempty"`
+	AOVOutput string    `json:"aovOutput,omitempty"`
+	Adaptive  *Adaptive `json:"adaptive,omitempty"`
+	// PNG showing how many samples each pixel took
+	HeatmapOutput string `json:"heatmapOutput,omitempty"`
+	// refine the whole image in passes of doubling sample counts, writing
+	// the current estimate to output every snapshotInterval seconds
+	Progressive      bool    `json:"progressive,omitempty"`
+	SnapshotInterval float64 `json:"snapshotInterval,omitempty"`
+	// progressive renders save their state to checkpoint every
+	// checkpointInterval seconds (default 60) and when interrupted
+	Checkpoint         string  `json:"checkpoint,omitempty"`
+	CheckpointInterval float64 `json:"checkpointInterval,omitempty"`
+	// rendering goroutines (default all cores but one), tile edge in pixels
+	// (default 32) and tile order: random (default), scanline, spiral or
+	// hilbert
+	Threads   int    `json:"threads,omitempty"`
+	TileSize  int    `json:"tileSize,omitempty"`
+	TileOrder string `json:"tileOrder,omitempty"`
+	// the same seed renders the same image
+	Seed uint64 `json:"seed,omitempty"`
+}
+
+// Adaptive stops sampling pixels whose noise is below threshold, maxSamples
+// defaults to the camera's samplesPerPixel and minSamples to 16 (or
+// maxSamples if lower).
+type Adaptive struct {
+	Threshold  float64 `json:"threshold"`
+	MinSamples int     `json:"minSamples,omitempty"`
+	MaxSamples int     `json:"maxSamples,omitempty"`
+}
+
+// Denoise selects the bilateral filter on the display image (the default),
+// or a filter on the linear color: joint bilateral (zero feature sigmas
+// ignore the feature), À-Trous (zero values use the defaults, rangeSigma is
+// the luminance sigma) or non-local means (zero values use the defaults).
+type Denoise struct {
+	Type         string  `json:"type,omitempty"`
+	SpatialSigma float64 `json:"spatialSigma,omitempty"`
+	RangeSigma   float64 `json:"rangeSigma,omitempty"`
+	AlbedoSigma  float64 `json:"albedoSigma,omitempty"`
+	NormalSigma  float64 `json:"normalSigma,omitempty"`
+	DepthSigma   float64 `json:"depthSigma,omitempty"`
+	Iterations   int     `json:"iterations,omitempty"`
+	SearchRadius int     `json:"searchRadius,omitempty"`
+	PatchRadius  int     `json:"patchRadius,omitempty"`
+	Strength     float64 `json:"strength,omitempty"`
+}
+
+type Material struct {
+	Type            string  `json:"type"`
+	Albedo          Vector  `json:"albedo,omitempty"`
+	Fuzz            float64 `json:"fuzz,omitempty"`
+	RefractionIndex float64 `json:"refractionIndex,omitempty"`
+	Emit            Vector  `json:"emit,omitempty"`
+	// name of a texture replacing albedo (or emit for lights)
+	Texture string `json:"texture,omitempty"`
+}
+
+type Texture struct {
+	Type  string  `json:"type"`
+	Color Vector  `json:"color,omitempty"`
+	Scale float64 `json:"scale,omitempty"`
+	Even  Vector  `json:"even,omitempty"`
+	Odd   Vector  `json:"odd,omitempty"`
+	File  string  `json:"file,omitempty"`
+	Wrap  string  `json:"wrap,omitempty"`
+	Style string  `json:"style,omitempty"`
+	Seed  uint64  `json:"seed,omitempty"`
+}
+
+// Background describes what rays leaving the scene see, omitting it keeps
+// the sky gradient.
+type Background struct {
+	Type  string `json:"type"`
+	Color Vector `json:"color,omitempty"`
+	// equirectangular image for environment backgrounds, rotated around the
+	// up axis by rotation degrees
+	File     string  `json:"file,omitempty"`
+	Rotation float64 `json:"rotation,omitempty"`
+}
+
+type Object struct {
+	Type     string   `json:"type"`
+	Material string   `json:"material,omitempty"`
+	Center   Vector   `json:"center,omitempty"`
+	Radius   float64  `json:"radius,omitempty"`
+	Vertices []Vector `json:"vertices,omitempty"`
+	File     string   `json:"file,omitempty"`
+}
+
+func New() *Scene {
+	return &Scene{Version: Version, Materials: map[string]Material{}}
+}
+
+func Load(path string) (*Scene, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	s, err := Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s.dir = filepath.Dir(path)
+	return s, nil
+}
+
+func Decode(r io.Reader) (*Scene, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	s := &Scene{}
+	if err := dec.Decode(s); err != nil {
+		return nil, jsonError(data, err)
+	}
+	if s.Version != Version {
+		return nil, &PathError{Path: "version", Err: fmt.Errorf("unsupported version %d, expected %d", s.Version, Version)}
+	}
+	return s, nil
+}
+
+func (s *Scene) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := s.Encode(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (s *Scene) Encode(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// Hash identifies what the rendered samples depend on: the camera, the
+// integrator, the seed and the world. The sample count is left out, so a
+// checkpointed render can be resumed with more samples. Files referenced by
+// the scene are identified by their absolute path only, so the scene can be
+// loaded through any path or working directory.
+func (s *Scene) Hash() string {
+	camera := s.Camera
+	camera.SamplesPerPixel = 0
+	var background *Background
+	if s.Background != nil {
+		bg := *s.Background
+		bg.File = s.absolute(bg.File)
+		background = &bg
+	}
+	textures := map[string]Texture{}
+	for name, t := range s.Textures {
+		t.File = s.absolute(t.File)
+		textures[name] = t
+	}
+	objects := make([]Object, len(s.Objects))
+	for i, obj := range s.Objects {
+		obj.File = s.absolute(obj.File)
+		objects[i] = obj
+	}
+	data, _ := json.Marshal(struct {
+		Camera     Camera
+		Integrator string
+		AODistance float64
+		Seed       uint64
+		Background *Background
+		Textures   map[string]Texture
+		Materials  map[string]Material
+		Objects    []Object
+	}{camera, s.Render.Integrator, s.Render.AODistance, s.Render.Seed, background, textures, s.Materials, objects})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// resolve returns the path of a file referenced by the scene.
+func (s *Scene) resolve(file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(s.dir, file)
+}
+
+func (s *Scene) absolute(file string) string {
+	if file == "" {
+		return ""
+	}
+	path, err := filepath.Abs(s.resolve(file))
+	if err != nil {
+		return s.resolve(file)
+	}
+	return path
+}
+
+// SetDir sets the directory relative file references are resolved from,
+// Load sets it to the directory of the scene file.
+func (s *Scene) SetDir(dir string) {
+	s.dir = dir
+}
+
+func (s *Scene) Dir() string {
+	return s.dir
+}
+
+// Warnings lists the problems the last Build went on with, e.g. a missing
+// material library of a model.
+func (s *Scene) Warnings() []error {
+	return s.warnings
+}
+
+func jsonError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("%s: %w", position(data, syntaxErr.Offset), err)
+	case errors.As(err, &typeErr):
+		path, ok := valuePath(json.NewDecoder(bytes.NewReader(data)), "", typeErr.Offset)
+		if !ok {
+			path = typeErr.Field
+		}
+		return &PathError{
+			Path: path,
+			Err:  fmt.Errorf("%s: expected %s, got %s", position(data, typeErr.Offset), typeErr.Type, typeErr.Value),
+		}
+	default:
+		return err
+	}
+}
+
+// valuePath walks the next value of dec and returns the path, with array
+// indices, of the innermost value ending at or spanning offset.
+// UnmarshalTypeError only has the dotted field names.
+func valuePath(dec *json.Decoder, path string, offset int64) (string, bool) {
+	start := dec.InputOffset()
+	tok, err := dec.Token()
+	if err != nil {
+		return "", false
+	}
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return "", false
+			}
+			field := fmt.Sprint(key)
+			if path != "" {
+				field = path + "." + field
+			}
+			if p, ok := valuePath(dec, field, offset); ok {
+				return p, true
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return "", false
+		}
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			if p, ok := valuePath(dec, fmt.Sprintf("%s[%d]", path, i), offset); ok {
+				return p, true
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return "", false
+		}
+	}
+	return path, start < offset && offset <= dec.InputOffset()
+}
+
+func position(data []byte, offset int64) string {
+	offset = min(offset, int64(len(data)))
+	line := bytes.Count(data[:offset], []byte("\n")) + 1
+	col := offset - int64(bytes.LastIndexByte(data[:offset], '\n'))
+	return fmt.Sprintf("line %d, column %d", line, col)
+}
@@ -0,0 +1,127 @@
+package scene
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testScene() *Scene {
+	doc := New()
+	doc.Camera = Camera{
+		Width:           64,
+		AspectRatio:     1.5,
+		SamplesPerPixel: 8,
+		MaxDepth:        10,
+		VFov:            40,
+		LookFrom:        Vector{0, 1, 5},
+		LookAt:          Vector{0, 0, 0},
+		DefocusAngle:    0.5,
+		FocusDist:       5,
+	}
+	doc.Render = Render{
+		Output:     "out.png",
+		Denoise:    &Denoise{Type: "atrous", Iterations: 4},
+		Integrator: "path",
+		ToneMap:    "aces",
+		Exposure:   0.5,
+		AOVs:       []string{"albedo", "normal"},
+		AOVOutput:  "aovs.exr",
+		Adaptive:   &Adaptive{Threshold: 0.01, MinSamples: 4},
+		TileOrder:  "hilbert",
+		Seed:       3,
+	}
+	doc.Background = &Background{Type: "color", Color: Vector{0.1, 0.2, 0.3}}
+	doc.Textures = map[string]Texture{
+		"checks": {Type: "checker", Scale: 2, Even: Vector{1, 1, 1}, Odd: Vector{0, 0, 0}},
+		"marble": {Type: "noise", Scale: 4, Style: "marble", Seed: 9},
+	}
+	doc.Materials["floor"] = Material{Type: "lambertian", Texture: "checks"}
+	doc.Materials["glass"] = Material{Type: "dielectric", RefractionIndex: 1.5}
+	doc.Materials["stone"] = Material{Type: "metal", Texture: "marble", Fuzz: 0.3}
+	doc.Materials["lamp"] = Material{Type: "diffuse_light", Emit: Vector{4, 4, 4}}
+	doc.Objects = []Object{
+		{Type: "sphere", Center: Vector{0, -100.5, 0}, Radius: 100, Material: "floor"},
+		{Type: "sphere", Center: Vector{0, 0, 0}, Radius: 0.5, Material: "glass"},
+		{Type: "triangle", Vertices: []Vector{{-1, 2, 0}, {1, 2, 0}, {0, 2, 1}}, Material: "lamp"},
+	}
+	return doc
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	doc := testScene()
+	if _, _, err := doc.Build(); err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.Buffer{}
+	if err := doc.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.String()
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.warnings = nil
+	if !reflect.DeepEqual(decoded, doc) {
+		t.Errorf("decoded scene differs:\n%s", encoded)
+	}
+	if decoded.Hash() != doc.Hash() {
+		t.Error("decoded scene hashes differently")
+	}
+}
+
+func TestDecodeErrorPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		path string
+	}{
+		{"object field", `{"version": 1, "objects": [{}, {"radius": "big"}]}`, "objects[1].radius"},
+		{"vector component", `{"version": 1, "objects": [{"center": [0, 0, 0]}, {}, {"center": [0, "x", 0]}]}`, "objects[2].center[1]"},
+		{"object instead of vector", `{"version": 1, "camera": {"lookAt": {"x": 1}}}`, "camera.lookAt"},
+		{"map entry", `{"version": 1, "materials": {"red": {"fuzz": "no"}}}`, "materials.red.fuzz"},
+	}
+	for _, test := range tests {
+		_, err := Decode(strings.NewReader(test.json))
+		var pathErr *PathError
+		if !errors.As(err, &pathErr) || pathErr.Path != test.path {
+			t.Errorf("%s: got error %v, expected one at %s", test.name, err, test.path)
+		}
+	}
+}
+
+func TestBuildErrorPaths(t *testing.T) {
+	doc := testScene()
+	doc.Objects[1].Material = "glas"
+	_, _, err := doc.Build()
+	if err == nil || err.Error() != `objects[1].material: unknown "glas"` {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestBuildAdaptiveSampleBounds(t *testing.T) {
+	tests := []struct {
+		adaptive Adaptive
+		want     string
+	}{
+		{Adaptive{Threshold: 0.01, MinSamples: 4}, ""},
+		{Adaptive{Threshold: 0.01, MinSamples: 64, MaxSamples: 128}, ""},
+		{Adaptive{Threshold: 0.01, MinSamples: 64, MaxSamples: 32}, "render.adaptive.minSamples: must not exceed maxSamples (32), got 64"},
+		{Adaptive{Threshold: 0.01, MinSamples: 64}, "render.adaptive.minSamples: must not exceed camera.samplesPerPixel (8) used as maxSamples, got 64"},
+	}
+	for _, test := range tests {
+		doc := testScene()
+		doc.Render.Adaptive = &test.adaptive
+		_, _, err := doc.Build()
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("%+v: got error %q, expected %q", test.adaptive, got, test.want)
+		}
+	}
+}
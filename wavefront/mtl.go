@@ -0,0 +1,145 @@
+package wavefront
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"raytracer/math3"
+	"raytracer/raytracer"
+	"strconv"
+	"strings"
+)
+
+// MTL holds the subset of a material library statement the renderer can map
+// onto its own materials.
+type MTL struct {
+	Name     string
+	Kd       math3.Vec3
+	Ks       math3.Vec3
+	Ns       float64
+	Ni       float64
+	Dissolve float64
+	Illum    int
+	hasSpec  bool
+}
+
+func newMTL(name string) *MTL {
+	return &MTL{Name: name, Kd: math3.Vec3{0.8, 0.8, 0.8}, Ni: 1, Dissolve: 1}
+}
+
+func ParseMTL(r io.Reader) (map[string]*MTL, error) {
+	materials := map[string]*MTL{}
+	var current *MTL
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		fields := strings.Fields(stripComment(scanner.Text()))
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "newmtl" {
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("line %d: newmtl without a name", lineNo)
+			}
+			current = newMTL(strings.Join(fields[1:], " "))
+			materials[current.Name] = current
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		var err error
+		switch fields[0] {
+		case "Kd":
+			current.Kd, err = parseColor(fields[1:])
+		case "Ks":
+			current.Ks, err = parseColor(fields[1:])
+			current.hasSpec = true
+		case "Ns":
+			current.Ns, err = parseFloat(fields[1:])
+		case "Ni":
+			current.Ni, err = parseFloat(fields[1:])
+		case "d":
+			current.Dissolve, err = parseFloat(fields[1:])
+		case "Tr":
+			var tr float64
+			tr, err = parseFloat(fields[1:])
+			current.Dissolve = 1 - tr
+		case "illum":
+			var illum float64
+			illum, err = parseFloat(fields[1:])
+			current.Illum = int(illum)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", lineNo, fields[0], err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return materials, nil
+}
+
+// Material maps the statement onto Dialectric for transparent or refracting
+// illumination models, Metal for reflective ones and Lambertian otherwise.
+func (m *MTL) Material() raytracer.Material {
+	switch {
+	case m.Dissolve < 1 || m.Illum == 4 || m.Illum == 6 || m.Illum == 7 || m.Illum == 9:
+		ri := m.Ni
+		if ri <= 1 {
+			ri = 1.5
+		}
+		return raytracer.Dialectric{RefractionIndex: ri}
+	case m.Illum == 3 || m.Illum == 5 || m.Illum == 8 || m.isSpecularOnly():
+		albedo := m.Ks
+		if albedo.MaxComponent() <= 0 {
+			albedo = m.Kd
+		}
+		return raytracer.Metal{Albedo: raytracer.SolidColor{Albedo: albedo}, Fuzz: m.fuzz()}
+	default:
+		return raytracer.Lambertian{Albedo: raytracer.SolidColor{Albedo: m.Kd}}
+	}
+}
+
+func (m *MTL) isSpecularOnly() bool {
+	return m.hasSpec && m.Kd.MaxComponent() <= 0 && m.Ks.MaxComponent() > 0
+}
+
+// fuzz converts the Phong exponent to a roughness, Ns = 0 is fully rough
+// and the usual 1000 upper bound is close to a mirror.
+func (m *MTL) fuzz() float64 {
+	return math3.Interval{Min: 0, Max: 1}.Clamp(math.Sqrt(2 / (m.Ns + 2)))
+}
+
+// parseColor reads an RGB color, a single value applies to every channel.
+func parseColor(fields []string) (math3.Vec3, error) {
+	if len(fields) == 0 {
+		return math3.Vec3{}, errMissingValue
+	}
+	v := math3.Vec3{}
+	for i := range 3 {
+		s := fields[min(i, len(fields)-1)]
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return math3.Vec3{}, err
+		}
+		v[i] = f
+	}
+	return v, nil
+}
+
+func parseFloat(fields []string) (float64, error) {
+	if len(fields) == 0 {
+		return 0, errMissingValue
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+func stripComment(line string) string {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
@@ -0,0 +1,294 @@
+package wavefront
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"raytracer/math3"
+	"raytracer/raytracer"
+	"strconv"
+	"strings"
+)
+
+var errMissingValue = errors.New("missing value")
+
+var DefaultMaterial raytracer.Material = raytracer.Lambertian{
+	Albedo: raytracer.SolidColor{Albedo: math3.Vec3{0.8, 0.8, 0.8}},
+}
+
+// Model is a parsed OBJ file, every (group, material) pair becomes its own
+// mesh and all of them share the vertex, normal and uv buffers.
+type Model struct {
+	Positions []math3.Vec3
+	Normals   []math3.Vec3
+	UVs       [][2]float64
+	Groups    []Group
+	Materials map[string]*MTL
+	// problems that didn't stop the model from loading, e.g. a missing
+	// material library whose materials fall back to DefaultMaterial
+	Warnings []error
+}
+
+type Group struct {
+	Name     string
+	Material string
+	Faces    []raytracer.MeshFace
+}
+
+type parser struct {
+	model     *Model
+	dir       string
+	line      int
+	groupName string
+	material  string
+	groups    map[[2]string]int
+}
+
+// Load reads the OBJ file at path, along with the material libraries it
+// references, and adds one Mesh per group and material to world.
+func Load(world *raytracer.World, path string) error {
+	model, err := LoadModel(path)
+	if err != nil {
+		return err
+	}
+	for _, mesh := range model.Meshes() {
+		world.Add(mesh)
+	}
+	return nil
+}
+
+func LoadModel(path string) (*Model, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	model, err := Parse(file, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return model, nil
+}
+
+// Parse reads an OBJ stream, mtllib statements are resolved relative to dir.
+func Parse(r io.Reader, dir string) (*Model, error) {
+	p := &parser{
+		model:  &Model{Materials: map[string]*MTL{}},
+		dir:    dir,
+		groups: map[[2]string]int{},
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		p.line++
+		fields := strings.Fields(stripComment(scanner.Text()))
+		if len(fields) == 0 {
+			continue
+		}
+		if err := p.statement(fields); err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", p.line, fields[0], err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p.model, nil
+}
+
+func (p *parser) statement(fields []string) error {
+	m := p.model
+	switch fields[0] {
+	case "v":
+		v, err := parsePoint(fields[1:])
+		if err != nil {
+			return err
+		}
+		m.Positions = append(m.Positions, v)
+	case "vn":
+		n, err := parsePoint(fields[1:])
+		if err != nil {
+			return err
+		}
+		m.Normals = append(m.Normals, n)
+	case "vt":
+		uv, err := parseUV(fields[1:])
+		if err != nil {
+			return err
+		}
+		m.UVs = append(m.UVs, uv)
+	case "f":
+		return p.face(fields[1:])
+	case "g", "o":
+		p.groupName = strings.Join(fields[1:], " ")
+	case "usemtl":
+		p.material = strings.Join(fields[1:], " ")
+	case "mtllib":
+		for _, name := range fields[1:] {
+			err := p.loadMTL(name)
+			if errors.Is(err, fs.ErrNotExist) {
+				m.Warnings = append(m.Warnings, fmt.Errorf("line %d: mtllib: %w", p.line, err))
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *parser) face(fields []string) error {
+	if len(fields) < 3 {
+		return fmt.Errorf("face needs at least 3 vertices, got %d", len(fields))
+	}
+	type vertex struct{ v, t, n int }
+	vertices := make([]vertex, len(fields))
+	hasUVs, hasNormals := true, true
+	for i, field := range fields {
+		parts := strings.Split(field, "/")
+		var err error
+		vertices[i].v, err = resolveIndex(parts[0], len(p.model.Positions))
+		if err != nil {
+			return err
+		}
+		vertices[i].t, vertices[i].n = -1, -1
+		if len(parts) > 1 && parts[1] != "" {
+			if vertices[i].t, err = resolveIndex(parts[1], len(p.model.UVs)); err != nil {
+				return err
+			}
+		}
+		if len(parts) > 2 && parts[2] != "" {
+			if vertices[i].n, err = resolveIndex(parts[2], len(p.model.Normals)); err != nil {
+				return err
+			}
+		}
+		hasUVs = hasUVs && vertices[i].t >= 0
+		hasNormals = hasNormals && vertices[i].n >= 0
+	}
+
+	group := p.group()
+	// triangulate polygons as a fan around the first vertex
+	for i := 1; i+1 < len(vertices); i++ {
+		a, b, c := vertices[0], vertices[i], vertices[i+1]
+		face := raytracer.NewMeshFace(a.v, b.v, c.v)
+		if hasUVs {
+			face.UVs = [3]int{a.t, b.t, c.t}
+		}
+		if hasNormals {
+			face.Normals = [3]int{a.n, b.n, c.n}
+		}
+		group.Faces = append(group.Faces, face)
+	}
+	return nil
+}
+
+func (p *parser) group() *Group {
+	key := [2]string{p.groupName, p.material}
+	index, ok := p.groups[key]
+	if !ok {
+		index = len(p.model.Groups)
+		p.groups[key] = index
+		p.model.Groups = append(p.model.Groups, Group{Name: p.groupName, Material: p.material})
+	}
+	return &p.model.Groups[index]
+}
+
+func (p *parser) loadMTL(name string) error {
+	file, err := os.Open(filepath.Join(p.dir, name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	materials, err := ParseMTL(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	for k, v := range materials {
+		p.model.Materials[k] = v
+	}
+	return nil
+}
+
+// Meshes builds a Mesh per group, groups using a material missing from the
+// libraries fall back to DefaultMaterial. Material IDs number the materials
+// in the order groups use them, starting at 1.
+func (m *Model) Meshes() []*raytracer.Mesh {
+	meshes := make([]*raytracer.Mesh, 0, len(m.Groups))
+	// by material name, "" stands for DefaultMaterial
+	ids := map[string]int{}
+	for _, group := range m.Groups {
+		if len(group.Faces) == 0 {
+			continue
+		}
+		name, material := "", DefaultMaterial
+		if mtl, ok := m.Materials[group.Material]; ok {
+			name, material = group.Material, mtl.Material()
+		}
+		if _, seen := ids[name]; !seen {
+			ids[name] = len(ids) + 1
+		}
+		meshes = append(meshes, &raytracer.Mesh{
+			Positions:  m.Positions,
+			Normals:    m.Normals,
+			UVs:        m.UVs,
+			Faces:      group.Faces,
+			Material:   material,
+			MaterialID: ids[name],
+		})
+	}
+	return meshes
+}
+
+// resolveIndex converts a 1-based (or negative, relative to the end) OBJ
+// index into a 0-based one.
+func resolveIndex(s string, count int) (int, error) {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 {
+		i += count
+	} else {
+		i--
+	}
+	if i < 0 || i >= count {
+		return 0, fmt.Errorf("index %s out of range (%d elements)", s, count)
+	}
+	return i, nil
+}
+
+// parsePoint reads the x, y and z of a vertex or normal, an optional w is
+// ignored.
+func parsePoint(fields []string) (math3.Vec3, error) {
+	if len(fields) < 3 {
+		return math3.Vec3{}, fmt.Errorf("expected 3 values, got %d", len(fields))
+	}
+	v := math3.Vec3{}
+	for i := range 3 {
+		f, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return math3.Vec3{}, err
+		}
+		v[i] = f
+	}
+	return v, nil
+}
+
+func parseUV(fields []string) ([2]float64, error) {
+	if len(fields) == 0 {
+		return [2]float64{}, errMissingValue
+	}
+	uv := [2]float64{}
+	for i := 0; i < 2 && i < len(fields); i++ {
+		f, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return [2]float64{}, err
+		}
+		uv[i] = f
+	}
+	return uv, nil
+}
@@ -0,0 +1,113 @@
+package wavefront
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"raytracer/math3"
+	"raytracer/raytracer"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	dir := t.TempDir()
+	mtl := "newmtl red\nKd 0.7 0.1 0.1\n\nnewmtl grey\nKd 0.5\n"
+	if err := os.WriteFile(filepath.Join(dir, "scene.mtl"), []byte(mtl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	obj := `# a quad and a triangle
+mtllib scene.mtl
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0 1.0
+vt 0 0
+vt 1 0
+vt 1 1
+vt 0 1
+vn 0 0 1
+g quad
+usemtl red
+f 1/1/1 2/2/1 3/3/1 4/4/1
+g tri
+usemtl grey
+f -4 -3 -2
+usemtl missing
+f 1 3 4
+`
+	model, err := Parse(strings.NewReader(obj), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(model.Positions) != 4 || model.Positions[3] != (math3.Vec3{0, 1, 0}) {
+		t.Errorf("positions %v", model.Positions)
+	}
+	if len(model.Warnings) != 0 {
+		t.Errorf("unexpected warnings %v", model.Warnings)
+	}
+	if got := model.Materials["grey"].Kd; got != (math3.Vec3{0.5, 0.5, 0.5}) {
+		t.Errorf("Kd with one value is %v, expected it on every channel", got)
+	}
+
+	if len(model.Groups) != 3 {
+		t.Fatalf("got %d groups, expected 3", len(model.Groups))
+	}
+	quad := model.Groups[0]
+	if quad.Name != "quad" || quad.Material != "red" || len(quad.Faces) != 2 {
+		t.Fatalf("quad group %+v, expected 2 triangles using red", quad)
+	}
+	want := raytracer.MeshFace{Vertices: [3]int{0, 2, 3}, Normals: [3]int{0, 0, 0}, UVs: [3]int{0, 2, 3}}
+	if quad.Faces[1] != want {
+		t.Errorf("second triangle of the quad %+v, expected %+v", quad.Faces[1], want)
+	}
+	if got := model.Groups[1].Faces[0]; got != raytracer.NewMeshFace(0, 1, 2) {
+		t.Errorf("negative indices resolved to %+v", got)
+	}
+
+	meshes := model.Meshes()
+	if len(meshes) != 3 {
+		t.Fatalf("got %d meshes, expected 3", len(meshes))
+	}
+	if meshes[2].Material != DefaultMaterial {
+		t.Errorf("unknown material name didn't fall back to DefaultMaterial")
+	}
+	if ids := [3]int{meshes[0].MaterialID, meshes[1].MaterialID, meshes[2].MaterialID}; ids != [3]int{1, 2, 3} {
+		t.Errorf("material IDs %v, expected 1, 2, 3", ids)
+	}
+}
+
+func TestParseMissingMTL(t *testing.T) {
+	obj := "mtllib missing.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nusemtl red\nf 1 2 3\n"
+	model, err := Parse(strings.NewReader(obj), t.TempDir())
+	if err != nil {
+		t.Fatalf("missing material library failed the model: %v", err)
+	}
+	if len(model.Warnings) != 1 || !errors.Is(model.Warnings[0], fs.ErrNotExist) {
+		t.Errorf("warnings %v, expected the missing library", model.Warnings)
+	}
+	if meshes := model.Meshes(); len(meshes) != 1 || meshes[0].Material != DefaultMaterial {
+		t.Errorf("faces of the missing material didn't fall back to DefaultMaterial")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  string
+		want string
+	}{
+		{"vertex with one value", "v 1\n", "line 1: v: expected 3 values, got 1"},
+		{"normal with two values", "vn 0 1\n", "line 1: vn: expected 3 values, got 2"},
+		{"vertex that isn't a number", "v 0 x 0\n", "line 1: v: "},
+		{"face with two vertices", "v 0 0 0\nv 1 0 0\nf 1 2\n", "line 3: f: face needs at least 3 vertices, got 2"},
+		{"index out of range", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 4\n", "line 4: f: index 4 out of range (3 elements)"},
+	}
+	for _, test := range tests {
+		_, err := Parse(strings.NewReader(test.obj), t.TempDir())
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, expected %q", test.name, err, test.want)
+		}
+	}
+}